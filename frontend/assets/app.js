@@ -1,7 +1,11 @@
 const state = {
   apiBase: localStorage.getItem('pgweb.apiBase') || 'http://localhost:8080',
+  session: localStorage.getItem('pgweb.session') || '',
   schema: '',
   table: '',
+  profile: '',
+  transaction: '',
+  confirmQuery: false,
 };
 
 const els = {
@@ -15,8 +19,19 @@ const els = {
   columnsList: document.getElementById('columns-list'),
   dataPreview: document.getElementById('data-preview'),
   queryResult: document.getElementById('query-result'),
+  runningQueries: document.getElementById('running-queries'),
+  transactionStatus: document.getElementById('transaction-status'),
+  txBegin: document.getElementById('btn-tx-begin'),
+  txCommit: document.getElementById('btn-tx-commit'),
+  txRollback: document.getElementById('btn-tx-rollback'),
+  batchOperations: document.getElementById('batch-operations'),
+  batchResult: document.getElementById('batch-result'),
   activeSchema: document.getElementById('active-schema'),
   activeTable: document.getElementById('active-table'),
+  connectForm: document.getElementById('connect-form'),
+  connectionMode: document.getElementById('connection-mode'),
+  profileSelect: document.getElementById('profile-select'),
+  profileSave: document.getElementById('btn-profile-save'),
 };
 
 els.apiInput.value = state.apiBase;
@@ -26,13 +41,37 @@ els.apiInput.addEventListener('change', () => {
   showToast('API base updated');
 });
 
+// Fields a connection URL carries. The form always sends them, so with a URL present their
+// defaults (including ssl_mode "disable") would override the URL's values on the server.
+const urlFields = ['host', 'port', 'database', 'username', 'password', 'ssl_mode'];
+
+function dropFieldsCoveredByURL(connection) {
+  if (!connection.url) return connection;
+  urlFields.forEach((field) => delete connection[field]);
+  return connection;
+}
+
 document.body.addEventListener('htmx:configRequest', (event) => {
   const target = event.target;
   if (!target) return;
 
-  let path = event.detail.path || target.getAttribute('hx-get') || target.getAttribute('hx-post') || '';
+  let path =
+    event.detail.path ||
+    target.getAttribute('hx-get') ||
+    target.getAttribute('hx-post') ||
+    target.getAttribute('hx-delete') ||
+    '';
   if (!path) return;
 
+  if (path.includes('{profile}')) {
+    if (!state.profile) {
+      event.preventDefault();
+      showToast('Select a profile first');
+      return;
+    }
+    path = path.replaceAll('{profile}', encodeURIComponent(state.profile));
+  }
+
   if (path.includes('{schema}')) {
     if (!state.schema) {
       event.preventDefault();
@@ -53,8 +92,23 @@ document.body.addEventListener('htmx:configRequest', (event) => {
   if (!/^https?:/i.test(path)) {
     path = buildApiUrl(path);
   }
+  const params = event.detail.parameters;
+  if (target.id === 'connect-form') {
+    dropFieldsCoveredByURL(params);
+  }
+  if (target.id === 'query-form' && state.transaction) {
+    params.transaction_id = state.transaction;
+  }
+  if (target.id === 'query-form' && state.confirmQuery) {
+    params.confirm = true;
+    state.confirmQuery = false;
+  }
+
   event.detail.path = path;
   event.detail.headers['Accept'] = 'application/json';
+  if (state.session) {
+    event.detail.headers['X-Pgweb-Session'] = state.session;
+  }
 });
 
 document.body.addEventListener('htmx:afterRequest', (event) => {
@@ -64,6 +118,7 @@ document.body.addEventListener('htmx:afterRequest', (event) => {
   if (!key) return;
 
   if (!event.detail.successful) {
+    if (target.id === 'query-form' && confirmDestructive(event, target)) return;
     handleError(event);
     return;
   }
@@ -87,10 +142,25 @@ document.body.addEventListener('htmx:sendError', handleError);
 
 const responseHandlers = {
   connect: (payload) => {
+    if (payload.session) {
+      state.session = payload.session;
+      localStorage.setItem('pgweb.session', state.session);
+    }
     els.connectMessage.textContent = payload.message || 'Connected';
+    updateConnectionMode(payload.read_only);
+    setTransaction('');
+  },
+  profiles: (payload) => {
+    renderProfiles(payload.profiles || []);
+  },
+  'profile-deleted': (payload) => {
+    showToast(payload.message || 'Profile deleted');
+    state.profile = '';
+    document.getElementById('btn-load-profiles').click();
   },
   validate: (payload) => {
     showToast(payload.message || 'Connection healthy');
+    updateConnectionMode(payload.read_only);
   },
   schemas: (payload) => {
     renderSchemas(payload.schemas || []);
@@ -112,17 +182,185 @@ const responseHandlers = {
     renderColumns(payload.columns || []);
   },
   'table-data': (payload) => {
-    renderTableData(payload.rows || []);
+    renderTableData(payload);
+  },
+  'running-queries': (payload) => {
+    renderRunningQueries(payload.queries || []);
   },
   query: (payload) => {
-    if (payload.rows_affected !== undefined) {
-      els.queryResult.innerHTML = `<p>${payload.rows_affected} row(s) affected.</p>`;
+    if (payload.results) {
+      renderScriptResults(payload.results, payload.stopped);
+    } else if (payload.rows_affected !== undefined) {
+      els.queryResult.innerHTML = `<p>${payload.command_tag || 'OK'} · ${payload.rows_affected} row(s) affected.</p>`;
     } else {
       renderResultTable(els.queryResult, payload.columns || [], payload.rows || []);
+      if (payload.truncated) {
+        els.queryResult.insertAdjacentHTML(
+          'beforeend',
+          `<p class="muted">Showing the first ${payload.rows.length} rows; the result was truncated.</p>`
+        );
+      }
     }
   },
 };
 
+function renderProfiles(items) {
+  els.profileSelect.innerHTML = '';
+  if (!items.length) {
+    els.profileSelect.innerHTML = '<option value="">No saved profiles</option>';
+    state.profile = '';
+    return;
+  }
+  items.forEach((profile) => {
+    const option = document.createElement('option');
+    option.value = profile.name;
+    option.textContent = `${profile.name} (${profile.connection.host}/${profile.connection.database})`;
+    els.profileSelect.appendChild(option);
+  });
+  if (!items.some((p) => p.name === state.profile)) {
+    state.profile = items[0].name;
+  }
+  els.profileSelect.value = state.profile;
+}
+
+els.profileSelect.addEventListener('change', () => {
+  state.profile = els.profileSelect.value;
+});
+
+els.profileSave.addEventListener('click', async () => {
+  const name = prompt('Profile name', state.profile || '');
+  if (!name) return;
+
+  const form = new FormData(els.connectForm);
+  const connection = dropFieldsCoveredByURL(Object.fromEntries(form.entries()));
+  connection.read_only = form.has('read_only');
+
+  const exists = Array.from(els.profileSelect.options).some((o) => o.value === name);
+  const response = await fetch(buildApiUrl(exists ? `/profiles/${encodeURIComponent(name)}` : '/profiles'), {
+    method: exists ? 'PUT' : 'POST',
+    headers: { 'Content-Type': 'application/json', Accept: 'application/json' },
+    body: JSON.stringify({ name, connection }),
+  });
+  if (!response.ok) {
+    showToast(await response.text());
+    return;
+  }
+  state.profile = name;
+  showToast(`Profile ${name} saved`);
+  document.getElementById('btn-load-profiles').click();
+});
+
+function renderRunningQueries(items) {
+  els.runningQueries.innerHTML = '';
+  if (!items.length) {
+    els.runningQueries.innerHTML = '<p class="muted">No running queries.</p>';
+    return;
+  }
+  items.forEach((q) => {
+    const row = document.createElement('div');
+    const label = document.createElement('span');
+    label.textContent = `PID ${q.pid} · ${Math.round(q.duration_ms / 1000)}s · ${q.query.slice(0, 80)}`;
+    const btn = document.createElement('button');
+    btn.textContent = 'Cancel';
+    btn.className = 'ghost';
+    btn.addEventListener('click', () => cancelQuery(q.id));
+    row.append(label, ' ', btn);
+    els.runningQueries.appendChild(row);
+  });
+}
+
+async function cancelQuery(id) {
+  const response = await fetch(buildApiUrl(`/queries/${encodeURIComponent(id)}/cancel`), {
+    method: 'POST',
+    headers: { Accept: 'application/json', 'X-Pgweb-Session': state.session },
+  });
+  showToast(response.ok ? 'Cancel requested' : await response.text());
+  document.getElementById('btn-running-queries').click();
+}
+
+els.txBegin.addEventListener('click', () => transactionRequest('/transactions', 'Transaction started'));
+els.txCommit.addEventListener('click', () =>
+  transactionRequest(`/transactions/${encodeURIComponent(state.transaction)}/commit`, 'Transaction ended')
+);
+els.txRollback.addEventListener('click', () =>
+  transactionRequest(`/transactions/${encodeURIComponent(state.transaction)}/rollback`, 'Transaction rolled back')
+);
+
+async function transactionRequest(path, message) {
+  const response = await fetch(buildApiUrl(path), {
+    method: 'POST',
+    headers: { Accept: 'application/json', 'X-Pgweb-Session': state.session },
+  });
+  if (!response.ok) {
+    showToast(await response.text());
+    // A transaction the server no longer knows about can't be used again.
+    if (response.status === 404) setTransaction('');
+    return;
+  }
+  const payload = await response.json();
+  if (path === '/transactions') {
+    setTransaction(payload.id);
+    showToast(message);
+  } else {
+    setTransaction('');
+    showToast(payload.command_tag ? `${message}: ${payload.command_tag}` : message);
+  }
+}
+
+function setTransaction(id) {
+  state.transaction = id;
+  els.transactionStatus.textContent = id ? `Transaction ${id}` : 'No transaction';
+  els.txBegin.disabled = Boolean(id);
+  els.txCommit.disabled = !id;
+  els.txRollback.disabled = !id;
+}
+
+document.getElementById('btn-batch-preview').addEventListener('click', () => submitBatch(false));
+document.getElementById('btn-batch-apply').addEventListener('click', () => submitBatch(true));
+
+async function submitBatch(confirm) {
+  let operations;
+  try {
+    operations = JSON.parse(els.batchOperations.value);
+  } catch (err) {
+    showToast(`Invalid JSON: ${err.message}`);
+    return;
+  }
+  const response = await fetch(buildApiUrl('/rows/batch'), {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+      Accept: 'application/json',
+      'X-Pgweb-Session': state.session,
+    },
+    body: JSON.stringify({ operations, confirm }),
+  });
+  const text = await response.text();
+  let payload;
+  try {
+    payload = JSON.parse(text);
+  } catch {
+    showToast(text);
+    return;
+  }
+  if (payload.error) showToast(payload.error);
+  renderBatchResults(payload.results || []);
+}
+
+function renderBatchResults(results) {
+  els.batchResult.innerHTML = '';
+  results.forEach((res) => {
+    const row = document.createElement('div');
+    const status = document.createElement('span');
+    status.className = res.status === 'failed' ? 'error' : 'muted';
+    status.textContent = `#${res.index + 1} ${res.status}${res.error ? `: ${res.error}` : ''}`;
+    const sql = document.createElement('pre');
+    sql.textContent = res.sql;
+    row.append(status, sql);
+    els.batchResult.appendChild(row);
+  });
+}
+
 function renderSchemas(items) {
   els.schemasList.innerHTML = '';
   if (!items.length) {
@@ -197,13 +435,43 @@ function renderColumns(columns) {
   els.columnsList.innerHTML = `<table><thead><tr><th>Name</th><th>Type</th><th>Constraints</th></tr></thead><tbody>${rows}</tbody></table>`;
 }
 
-function renderTableData(rows) {
+function renderTableData(payload) {
+  const rows = payload.rows || [];
   if (!rows.length) {
     els.dataPreview.innerHTML = '<p class="muted">No rows.</p>';
     return;
   }
-  const columns = Object.keys(rows[0]);
-  renderResultTable(els.dataPreview, columns, rows);
+  renderResultTable(els.dataPreview, payload.columns || [], rows);
+
+  const footer = document.createElement('p');
+  footer.className = 'muted';
+  const total =
+    payload.total_count !== undefined
+      ? `${payload.total_count} rows`
+      : payload.estimated_count !== undefined
+        ? `~${payload.estimated_count} rows`
+        : '';
+  footer.textContent = [`Showing ${rows.length}`, total].filter(Boolean).join(' of ');
+  if (payload.next_cursor) {
+    const next = document.createElement('button');
+    next.className = 'ghost';
+    next.textContent = 'Next page';
+    next.addEventListener('click', () => loadTableDataPage(payload.next_cursor));
+    footer.append(' ', next);
+  }
+  els.dataPreview.appendChild(footer);
+}
+
+async function loadTableDataPage(cursor) {
+  const path = `/schemas/${encodeURIComponent(state.schema)}/tables/${encodeURIComponent(state.table)}/data`;
+  const response = await fetch(buildApiUrl(`${path}?cursor=${encodeURIComponent(cursor)}`), {
+    headers: { Accept: 'application/json', 'X-Pgweb-Session': state.session },
+  });
+  if (!response.ok) {
+    showToast(await response.text());
+    return;
+  }
+  renderTableData(await response.json());
 }
 
 function renderResultTable(container, columns, rows) {
@@ -211,21 +479,48 @@ function renderResultTable(container, columns, rows) {
     container.innerHTML = '<p class="muted">No data.</p>';
     return;
   }
-  const head = columns.map((c) => `<th>${c}</th>`).join('');
+  const head = columns.map((c) => `<th title="${c.type}">${c.name}</th>`).join('');
   const body = rows
     .map((row) => {
-      const cells = columns
-        .map((c) => `<td>${formatValue(row[c])}</td>`)
-        .join('');
+      const cells = row.map((value) => `<td>${formatValue(value)}</td>`).join('');
       return `<tr>${cells}</tr>`;
     })
     .join('');
   container.innerHTML = `<table><thead><tr>${head}</tr></thead><tbody>${body}</tbody></table>`;
 }
 
+function renderScriptResults(results, stopped) {
+  els.queryResult.innerHTML = '';
+  results.forEach((res, i) => {
+    const block = document.createElement('div');
+    block.className = 'script-result';
+    const title = document.createElement('p');
+    title.className = res.error ? 'error' : 'muted';
+    const summary = res.error
+      ? `Error: ${res.error}`
+      : res.columns
+        ? `${res.rows.length} row(s)${res.truncated ? ' (truncated)' : ''}`
+        : `${res.command_tag} · ${res.rows_affected} row(s) affected`;
+    title.textContent = `#${i + 1} · ${res.duration_ms} ms · ${summary}`;
+    block.appendChild(title);
+    if (res.columns) {
+      const table = document.createElement('div');
+      renderResultTable(table, res.columns, res.rows || []);
+      block.appendChild(table);
+    }
+    els.queryResult.appendChild(block);
+  });
+  if (stopped) {
+    const note = document.createElement('p');
+    note.className = 'muted';
+    note.textContent = 'Script stopped at the first error; remaining statements were not run.';
+    els.queryResult.appendChild(note);
+  }
+}
+
 function formatValue(value) {
   if (value === null || value === undefined) return '<span class="muted">NULL</span>';
-  if (Array.isArray(value)) return value.join(', ');
+  if (typeof value === 'object') return JSON.stringify(value);
   return value;
 }
 
@@ -268,6 +563,10 @@ function highlightSelection(container, activeBtn) {
   if (activeBtn) activeBtn.classList.add('active');
 }
 
+function updateConnectionMode(readOnly) {
+  els.connectionMode.hidden = !readOnly;
+}
+
 function updateSchemaChip() {
   els.activeSchema.textContent = state.schema ? `Schema: ${state.schema}` : 'No schema selected';
 }
@@ -283,12 +582,35 @@ function buildApiUrl(path) {
   return `${state.apiBase.replace(/\/$/, '')}${path}`;
 }
 
+// A 409 with confirm_required lists destructive statements; ask before resending the query
+// with confirm set. Returns whether the response was handled here.
+function confirmDestructive(event, form) {
+  const xhr = event.detail?.xhr;
+  if (xhr?.status !== 409) return false;
+  let payload;
+  try {
+    payload = JSON.parse(xhr.responseText);
+  } catch (err) {
+    return false;
+  }
+  if (!payload.confirm_required) return false;
+
+  const lines = (payload.statements || []).map((st) => `• ${st.reason}:\n  ${st.statement}`);
+  if (window.confirm(`This query is destructive:\n\n${lines.join('\n')}\n\nRun it anyway?`)) {
+    state.confirmQuery = true;
+    form.requestSubmit();
+  }
+  return true;
+}
+
 function handleError(event, fallback) {
   const xhr = event.detail?.xhr;
   let message = fallback || xhr?.responseText || 'Request failed';
   try {
     const parsed = JSON.parse(message);
-    message = parsed.message || JSON.stringify(parsed);
+    // Answered by the confirmation dialog instead.
+    if (parsed.confirm_required) return;
+    message = parsed.message || parsed.error || JSON.stringify(parsed);
   } catch (err) {
     // ignore
   }
@@ -306,5 +628,8 @@ function showToast(message) {
   }, 3000);
 }
 
-// Pre-load schema list on startup
-setTimeout(() => document.getElementById('btn-load-schemas').click(), 500);
+// Pre-load schema and profile lists on startup
+setTimeout(() => {
+  document.getElementById('btn-load-schemas').click();
+  document.getElementById('btn-load-profiles').click();
+}, 500);
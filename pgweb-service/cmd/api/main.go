@@ -6,13 +6,39 @@ import (
 
 	"pgweb-service/internal/connection"
 	"pgweb-service/internal/http"
+	"pgweb-service/internal/secret"
 )
 
 func main() {
 	addr := ":8080"
 	mux := http.NewServeMux()
 
-	connectionHandler := connection.NewConnectionHandler()
+	cfg, err := connection.LoadConfig()
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	keyring, err := secret.LoadKeyring()
+	if err != nil {
+		log.Fatalf("failed to load encryption keys: %v", err)
+	}
+
+	profiles, err := connection.OpenProfileStore(cfg.ProfilesFile, keyring)
+	if err != nil {
+		log.Fatalf("failed to open profile store: %v", err)
+	}
+
+	history, err := connection.OpenHistoryStore(cfg.HistoryFile, cfg.HistoryMaxEntries)
+	if err != nil {
+		log.Fatalf("failed to open query history: %v", err)
+	}
+
+	snippets, err := connection.OpenSnippetStore(cfg.SnippetsFile)
+	if err != nil {
+		log.Fatalf("failed to open snippet store: %v", err)
+	}
+
+	connectionHandler := connection.NewConnectionHandler(cfg, profiles, history, snippets)
 	connectionHandler.Register(mux)
 
 	log.Printf("REST API listening on %s", addr)
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"pgweb-service/internal/connection"
+	"pgweb-service/internal/secret"
+)
+
+// rekey re-encrypts stored connection secrets under the current primary key.
+func main() {
+	generate := flag.Bool("generate-key", false, "print a new random key and exit")
+	flag.Parse()
+
+	if *generate {
+		key, err := secret.GenerateKey()
+		if err != nil {
+			log.Fatalf("failed to generate key: %v", err)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	cfg, err := connection.LoadConfig()
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	keyring, err := secret.LoadKeyring()
+	if err != nil {
+		log.Fatalf("failed to load encryption keys: %v", err)
+	}
+	if keyring == nil {
+		log.Fatal(secret.ErrNoKey)
+	}
+
+	profiles, err := connection.OpenProfileStore(cfg.ProfilesFile, keyring)
+	if err != nil {
+		log.Fatalf("failed to open profile store: %v", err)
+	}
+
+	rotated, err := profiles.Reencrypt()
+	if err != nil {
+		log.Fatalf("re-encryption failed: %v", err)
+	}
+
+	log.Printf("re-encrypted %s: %d of %d profiles needed rotation", cfg.ProfilesFile, rotated, len(profiles.List()))
+}
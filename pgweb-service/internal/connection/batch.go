@@ -0,0 +1,281 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pgweb-service/internal/sqlparse"
+	"pgweb-service/internal/util"
+
+	"github.com/lib/pq"
+)
+
+const maxBatchOperations = 1000
+
+// batchOperation is one staged row change in a POST /rows/batch request.
+type batchOperation struct {
+	Op     string         `json:"op"`
+	Schema string         `json:"schema"`
+	Table  string         `json:"table"`
+	Key    map[string]any `json:"key"`
+	Values map[string]any `json:"values"`
+}
+
+// batchStatement is a batchOperation compiled to SQL.
+type batchStatement struct {
+	op      batchOperation
+	query   string
+	args    []any
+	columns []tableColumn
+}
+
+// batchResult reports one operation. Status is "planned" in a preview and "applied",
+// "failed", "rolled_back" or "skipped" after an attempted commit.
+type batchResult struct {
+	Index   int           `json:"index"`
+	Op      string        `json:"op"`
+	Schema  string        `json:"schema"`
+	Table   string        `json:"table"`
+	SQL     string        `json:"sql"`
+	Status  string        `json:"status"`
+	Columns []util.Column `json:"columns,omitempty"`
+	Row     []any         `json:"row,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// BatchRows handles POST /rows/batch. Without "confirm": true it only compiles the operations
+// and returns the SQL that would run; with it, every operation runs in one transaction that
+// is rolled back as soon as any of them fails or misses its row.
+func (h *ConnectionHandler) BatchRows(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "This endpoint accepts only POST calls", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, conn, ok := h.ensureDB(w, req)
+	if !ok {
+		return
+	}
+	if conn.ReadOnly {
+		writeReadOnlyError(w)
+		return
+	}
+
+	var payload struct {
+		Operations []batchOperation `json:"operations"`
+		Confirm    BoolValue        `json:"confirm"`
+	}
+	dec := util.DecodeJsonBody(req)
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		http.Error(w, "Failed to decode request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(payload.Operations) == 0 {
+		http.Error(w, "operations are required", http.StatusBadRequest)
+		return
+	}
+	if len(payload.Operations) > maxBatchOperations {
+		http.Error(w, fmt.Sprintf("at most %d operations are allowed per batch", maxBatchOperations), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, ok := h.requestContext(w, req, conn, h.cfg.QueryTimeout)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	statements, status, err := compileBatch(payload.Operations, func(schemaName, tableName string) ([]tableColumn, tableKey, error) {
+		columns, err := tableColumns(ctx, db, schemaName, tableName)
+		if err != nil {
+			return nil, tableKey{}, err
+		}
+		key, err := lookupTableKey(ctx, db, schemaName, tableName)
+		return columns, key, err
+	})
+	if err != nil {
+		http.Error(w, "Invalid batch: "+err.Error(), status)
+		return
+	}
+
+	results := make([]batchResult, len(statements))
+	for i, st := range statements {
+		results[i] = batchResult{
+			Index:  i,
+			Op:     st.op.Op,
+			Schema: st.op.Schema,
+			Table:  st.op.Table,
+			SQL:    previewSQL(st.query, st.args),
+			Status: "planned",
+		}
+	}
+
+	if !payload.Confirm {
+		util.WriteJSON(w, http.StatusOK, map[string]any{
+			"dry_run": true,
+			"results": results,
+		})
+		return
+	}
+
+	if err := runBatch(ctx, db, statements, results); err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"error":     err.Error(),
+			"committed": false,
+			"results":   results,
+		})
+		return
+	}
+	util.WriteJSON(w, http.StatusOK, map[string]any{
+		"committed": true,
+		"results":   results,
+	})
+}
+
+// compileBatch builds the statement for every operation, looking up each table's columns and
+// key through describe once. The returned status is the HTTP status to use for the error.
+func compileBatch(ops []batchOperation, describe func(schemaName, tableName string) ([]tableColumn, tableKey, error)) ([]batchStatement, int, error) {
+	type tableMeta struct {
+		columns []tableColumn
+		key     tableKey
+	}
+	tables := make(map[[2]string]tableMeta)
+
+	statements := make([]batchStatement, len(ops))
+	for i, op := range ops {
+		if op.Schema == "" || op.Table == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("operation %d: schema and table are required", i)
+		}
+
+		meta, ok := tables[[2]string{op.Schema, op.Table}]
+		if !ok {
+			columns, key, err := describe(op.Schema, op.Table)
+			if errors.Is(err, errTableNotFound) {
+				return nil, http.StatusNotFound, fmt.Errorf("operation %d: table %s.%s not found", i, op.Schema, op.Table)
+			}
+			if err != nil {
+				return nil, http.StatusInternalServerError, fmt.Errorf("operation %d: %w", i, err)
+			}
+			meta = tableMeta{columns: columns, key: key}
+			tables[[2]string{op.Schema, op.Table}] = meta
+		}
+
+		change := rowChange{Key: op.Key, Values: op.Values}
+		query, args, err := buildRowStatement(op.Op, op.Schema, op.Table, change, meta.columns, meta.key)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("operation %d: %w", i, err)
+		}
+		statements[i] = batchStatement{op: op, query: query, args: args, columns: meta.columns}
+	}
+	return statements, http.StatusOK, nil
+}
+
+// runBatch executes statements in one transaction, filling in results as it goes. Any
+// failure rolls everything back and is returned.
+func runBatch(ctx context.Context, db *sql.DB, statements []batchStatement, results []batchResult) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	fail := func(i int, err error) error {
+		_ = tx.Rollback()
+		results[i].Status = "failed"
+		results[i].Error = err.Error()
+		for j := range results {
+			switch {
+			case j < i:
+				results[j].Status = "rolled_back"
+			case j > i:
+				results[j].Status = "skipped"
+			}
+		}
+		return fmt.Errorf("operation %d failed, transaction rolled back: %w", i, err)
+	}
+
+	for i, st := range statements {
+		rows, err := tx.QueryContext(ctx, st.query, st.args...)
+		if err != nil {
+			return fail(i, err)
+		}
+		columns, err := util.SQLColumns(rows)
+		if err != nil {
+			rows.Close()
+			return fail(i, err)
+		}
+		data, err := util.ReadSQLRows(rows, columns)
+		rows.Close()
+		if err != nil {
+			return fail(i, err)
+		}
+		markNullable(columns, st.columns)
+		if len(data) == 0 {
+			return fail(i, errors.New("no row matches the given key"))
+		}
+		results[i].Status = "applied"
+		results[i].Columns = columns
+		results[i].Row = data[0]
+	}
+
+	if err := tx.Commit(); err != nil {
+		for i := range results {
+			results[i].Status = "rolled_back"
+		}
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// previewSQL inlines args into query as SQL literals for display. The statement that runs
+// still uses bind parameters.
+func previewSQL(query string, args []any) string {
+	tokens, err := sqlparse.Tokenize(query)
+	if err != nil {
+		return query
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, t := range tokens {
+		if t.Kind != sqlparse.Param {
+			continue
+		}
+		n, err := strconv.Atoi(t.Value[1:])
+		if err != nil || n < 1 || n > len(args) {
+			continue
+		}
+		b.WriteString(query[last:t.Start])
+		b.WriteString(sqlLiteral(args[n-1]))
+		last = t.End
+	}
+	b.WriteString(query[last:])
+	return b.String()
+}
+
+func sqlLiteral(arg any) string {
+	v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+	if err != nil {
+		return "?"
+	}
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case []byte:
+		return pq.QuoteLiteral(string(v))
+	case string:
+		return pq.QuoteLiteral(v)
+	default:
+		return pq.QuoteLiteral(fmt.Sprint(v))
+	}
+}
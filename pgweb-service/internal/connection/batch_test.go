@@ -0,0 +1,83 @@
+package connection
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPreviewSQL(t *testing.T) {
+	ten := make([]any, 10)
+	for i := range ten {
+		ten[i] = int64(i + 1)
+	}
+	ten[0] = "first"
+	tests := []struct {
+		name  string
+		query string
+		args  []any
+		want  string
+	}{
+		{"$1 is not a prefix of $10", "SELECT $10, $1", ten, "SELECT 10, 'first'"},
+		{"placeholders in literals stay", "SELECT '$1', $1, \"$1\"", []any{"x"}, "SELECT '$1', 'x', \"$1\""},
+		{"quotes are doubled", "SELECT $1", []any{"O'Brien"}, "SELECT 'O''Brien'"},
+		{"NULL and booleans", "SELECT $1, $2, $3", []any{nil, true, false}, "SELECT NULL, true, false"},
+		{"json.Number", "SELECT $1", []any{json.Number("1.5")}, "SELECT '1.5'"},
+		{"unbindable value", "SELECT $1", []any{struct{}{}}, "SELECT ?"},
+		{"placeholder without an arg", "SELECT $1, $2", []any{int64(7)}, "SELECT 7, $2"},
+		{"unparsable query is shown as is", "SELECT $1, 'open", []any{int64(7)}, "SELECT $1, 'open"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := previewSQL(tt.query, tt.args); got != tt.want {
+				t.Errorf("previewSQL(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileBatchReportsFailingOperation(t *testing.T) {
+	described := 0
+	describe := func(schemaName, tableName string) ([]tableColumn, tableKey, error) {
+		described++
+		if tableName != "t" {
+			return nil, tableKey{}, errTableNotFound
+		}
+		return []tableColumn{{Name: "id"}, {Name: "name"}}, tableKey{Columns: []string{"id"}, Primary: true}, nil
+	}
+	valid := batchOperation{Op: "update", Schema: "public", Table: "t", Key: map[string]any{"id": json.Number("1")}, Values: map[string]any{"name": "x"}}
+
+	tests := []struct {
+		name   string
+		failed batchOperation
+		status int
+		want   string
+	}{
+		{"invalid change", batchOperation{Op: "update", Schema: "public", Table: "t", Key: map[string]any{"id": json.Number("2")}, Values: map[string]any{"nope": "x"}}, http.StatusBadRequest, `unknown column "nope"`},
+		{"missing table", batchOperation{Op: "delete", Schema: "public", Table: "gone", Key: map[string]any{"id": json.Number("2")}}, http.StatusNotFound, "table public.gone not found"},
+		{"no table", batchOperation{Op: "delete", Schema: "public"}, http.StatusBadRequest, "schema and table are required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			described = 0
+			_, status, err := compileBatch([]batchOperation{valid, valid, tt.failed, valid}, describe)
+			if err == nil || status != tt.status {
+				t.Fatalf("compileBatch = %d %v, want %d", status, err, tt.status)
+			}
+			if want := fmt.Sprintf("operation 2: %s", tt.want); !strings.Contains(err.Error(), want) {
+				t.Errorf("compileBatch error = %q, want %q", err, want)
+			}
+		})
+	}
+
+	described = 0
+	statements, _, err := compileBatch([]batchOperation{valid, valid}, describe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 2 || described != 1 {
+		t.Errorf("compileBatch = %d statements after %d lookups, want 2 after 1", len(statements), described)
+	}
+}
@@ -0,0 +1,145 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"pgweb-service/internal/util"
+
+	"github.com/lib/pq"
+)
+
+var errTableNotFound = errors.New("table not found")
+
+// tableColumn is a live column of a table, in attnum order.
+type tableColumn struct {
+	Name     string
+	Type     string
+	Nullable bool
+}
+
+// tableColumns lists the columns of schema.table, or errTableNotFound if it has none.
+func tableColumns(ctx context.Context, db *sql.DB, schemaName, tableName string) ([]tableColumn, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1
+		  AND c.relname = $2
+		  AND a.attnum > 0
+		  AND NOT a.attisdropped
+		ORDER BY a.attnum
+	`, schemaName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]tableColumn, 0)
+	for rows.Next() {
+		var c tableColumn
+		if err := rows.Scan(&c.Name, &c.Type, &c.Nullable); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, errTableNotFound
+	}
+	return columns, nil
+}
+
+// markNullable fills in Nullable for the result columns that name a column of the table.
+func markNullable(result []util.Column, columns []tableColumn) {
+	nullable := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		nullable[c.Name] = c.Nullable
+	}
+	for i := range result {
+		if n, ok := nullable[result[i].Name]; ok {
+			result[i].Nullable = &n
+		}
+	}
+}
+
+// tableKey names the columns that identify a row of schema.table: the primary key, or else
+// the narrowest unique index over NOT NULL columns. INCLUDE columns of an index are not part
+// of its key. Columns is empty when there is neither.
+type tableKey struct {
+	Columns []string
+	Primary bool
+}
+
+func lookupTableKey(ctx context.Context, db *sql.DB, schemaName, tableName string) (tableKey, error) {
+	var key tableKey
+	err := db.QueryRowContext(ctx, `
+		SELECT i.indisprimary, array_agg(a.attname ORDER BY k.ord)
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		CROSS JOIN LATERAL unnest(i.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+		WHERE n.nspname = $1
+		  AND c.relname = $2
+		  AND k.ord <= i.indnkeyatts
+		  AND i.indisunique
+		  AND i.indisvalid
+		  AND i.indpred IS NULL
+		  AND i.indexprs IS NULL
+		GROUP BY i.indexrelid, i.indisprimary
+		HAVING bool_and(a.attnotnull)
+		ORDER BY i.indisprimary DESC, count(*), i.indexrelid
+		LIMIT 1
+	`, schemaName, tableName).Scan(&key.Primary, pq.Array(&key.Columns))
+	if errors.Is(err, sql.ErrNoRows) {
+		return tableKey{}, nil
+	}
+	return key, err
+}
+
+// schemaIndex is an index of a table in a schema. Columns are its key columns in index order,
+// with "" standing for an expression.
+type schemaIndex struct {
+	Name    string
+	Table   string
+	Columns []string
+}
+
+// schemaIndexes lists the indexes of every table in schema, ordered by index name.
+func schemaIndexes(ctx context.Context, db *sql.DB, schemaName string) ([]schemaIndex, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT ic.relname, tc.relname,
+		       array(
+		           SELECT coalesce(a.attname, '')
+		           FROM unnest(i.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+		           LEFT JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+		           WHERE k.ord <= i.indnkeyatts
+		           ORDER BY k.ord
+		       )
+		FROM pg_index i
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		JOIN pg_class tc ON tc.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = tc.relnamespace
+		WHERE n.nspname = $1
+		ORDER BY ic.relname
+	`, schemaName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := make([]schemaIndex, 0)
+	for rows.Next() {
+		var idx schemaIndex
+		if err := rows.Scan(&idx.Name, &idx.Table, pq.Array(&idx.Columns)); err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, idx)
+	}
+	return indexes, rows.Err()
+}
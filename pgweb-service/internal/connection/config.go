@@ -0,0 +1,230 @@
+package connection
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultSessionIdleTimeout  = 30 * time.Minute
+	defaultProfilesFile        = "profiles.json"
+	defaultHistoryFile         = "history.jsonl"
+	defaultSnippetsFile        = "snippets.json"
+	defaultHistoryMaxEntries   = 10000
+	defaultPoolMaxOpenConns    = 10
+	defaultPoolMaxIdleConns    = 2
+	defaultPoolConnMaxLifetime = 30 * time.Minute
+	defaultPoolConnMaxIdleTime = 5 * time.Minute
+	defaultConnectTimeout      = 10 * time.Second
+	defaultCatalogTimeout      = 2 * time.Second
+	defaultTableDataTimeout    = 5 * time.Second
+	defaultQueryTimeout        = 15 * time.Second
+	defaultMaxQueryTimeout     = 10 * time.Minute
+	defaultTransactionIdle     = 5 * time.Minute
+	defaultMaxResultRows       = 10000
+	defaultMaxStreamRows       = 1000000
+	defaultJobTimeout          = time.Hour
+	defaultJobRetention        = time.Hour
+	defaultMaxJobRows          = 100000
+	defaultMaxSessionJobs      = 20
+)
+
+// Config holds server-wide settings for the connection handler.
+type Config struct {
+	// SessionIdleTimeout is how long a session may go unused before its pool is closed.
+	SessionIdleTimeout time.Duration
+	// ProfilesFile is the JSON file backing the connection profile store.
+	ProfilesFile string
+	// HistoryFile is the JSON Lines file backing the query history, which keeps the most
+	// recent HistoryMaxEntries statements.
+	HistoryFile       string
+	HistoryMaxEntries int
+	// SnippetsFile is the JSON file backing the saved query snippets.
+	SnippetsFile string
+	// CredentialsDir is the only directory connection payloads may name certificate, key
+	// and known_hosts files in. When empty, such material must be uploaded as content.
+	CredentialsDir string
+
+	// Pool defaults applied to every session unless its Connection.Pool overrides them.
+	PoolMaxOpenConns    int
+	PoolMaxIdleConns    int
+	PoolConnMaxLifetime time.Duration
+	PoolConnMaxIdleTime time.Duration
+
+	// ConnectTimeout bounds opening and pinging a connection, per sslmode attempt, and /validate,
+	// unless the connection sets its own connect_timeout.
+	ConnectTimeout time.Duration
+
+	// Default deadlines for catalog endpoints, table data and /query, used when neither the
+	// request nor the connection asks for one. MaxQueryTimeout caps any requested timeout.
+	CatalogTimeout   time.Duration
+	TableDataTimeout time.Duration
+	QueryTimeout     time.Duration
+	MaxQueryTimeout  time.Duration
+
+	// TransactionIdleTimeout is how long an interactive transaction may sit unused before it
+	// is rolled back and its connection returned to the pool.
+	TransactionIdleTimeout time.Duration
+
+	// Row caps for buffered /query results and for streamed ones. Results hitting the cap
+	// are cut short and marked truncated.
+	MaxResultRows int
+	MaxStreamRows int
+
+	// Background query jobs: JobTimeout is the default and maximum deadline of a job,
+	// JobRetention how long a finished job's result is kept, and MaxJobRows its row cap.
+	// MaxSessionJobs caps the jobs a session holds at once, running or retained, and
+	// MaxRunningJobs those of them running; it stays below PoolMaxOpenConns so jobs can't
+	// hold every pooled connection.
+	JobTimeout     time.Duration
+	JobRetention   time.Duration
+	MaxJobRows     int
+	MaxSessionJobs int
+	MaxRunningJobs int
+}
+
+// LoadConfig reads handler settings from PGWEB_* environment variables, falling back to defaults.
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		SessionIdleTimeout: defaultSessionIdleTimeout,
+		ProfilesFile:       defaultProfilesFile,
+		HistoryFile:        defaultHistoryFile,
+		HistoryMaxEntries:  defaultHistoryMaxEntries,
+		SnippetsFile:       defaultSnippetsFile,
+
+		PoolMaxOpenConns:    defaultPoolMaxOpenConns,
+		PoolMaxIdleConns:    defaultPoolMaxIdleConns,
+		PoolConnMaxLifetime: defaultPoolConnMaxLifetime,
+		PoolConnMaxIdleTime: defaultPoolConnMaxIdleTime,
+
+		ConnectTimeout: defaultConnectTimeout,
+
+		CatalogTimeout:   defaultCatalogTimeout,
+		TableDataTimeout: defaultTableDataTimeout,
+		QueryTimeout:     defaultQueryTimeout,
+		MaxQueryTimeout:  defaultMaxQueryTimeout,
+
+		TransactionIdleTimeout: defaultTransactionIdle,
+
+		MaxResultRows: defaultMaxResultRows,
+		MaxStreamRows: defaultMaxStreamRows,
+
+		JobTimeout:     defaultJobTimeout,
+		JobRetention:   defaultJobRetention,
+		MaxJobRows:     defaultMaxJobRows,
+		MaxSessionJobs: defaultMaxSessionJobs,
+	}
+
+	if path := os.Getenv("PGWEB_PROFILES_FILE"); path != "" {
+		cfg.ProfilesFile = path
+	}
+	if path := os.Getenv("PGWEB_HISTORY_FILE"); path != "" {
+		cfg.HistoryFile = path
+	}
+	if path := os.Getenv("PGWEB_SNIPPETS_FILE"); path != "" {
+		cfg.SnippetsFile = path
+	}
+	cfg.CredentialsDir = os.Getenv("PGWEB_CREDENTIALS_DIR")
+
+	var err error
+	if cfg.SessionIdleTimeout, err = durationFromEnv("PGWEB_SESSION_IDLE_TIMEOUT", cfg.SessionIdleTimeout); err != nil {
+		return Config{}, err
+	}
+	if cfg.HistoryMaxEntries, err = intFromEnv("PGWEB_HISTORY_MAX_ENTRIES", cfg.HistoryMaxEntries); err != nil {
+		return Config{}, err
+	}
+	if cfg.PoolMaxOpenConns, err = intFromEnv("PGWEB_POOL_MAX_OPEN_CONNS", cfg.PoolMaxOpenConns); err != nil {
+		return Config{}, err
+	}
+	if cfg.PoolMaxIdleConns, err = intFromEnv("PGWEB_POOL_MAX_IDLE_CONNS", cfg.PoolMaxIdleConns); err != nil {
+		return Config{}, err
+	}
+	if cfg.PoolConnMaxLifetime, err = durationFromEnv("PGWEB_POOL_CONN_MAX_LIFETIME", cfg.PoolConnMaxLifetime); err != nil {
+		return Config{}, err
+	}
+	if cfg.PoolConnMaxIdleTime, err = durationFromEnv("PGWEB_POOL_CONN_MAX_IDLE_TIME", cfg.PoolConnMaxIdleTime); err != nil {
+		return Config{}, err
+	}
+	if cfg.ConnectTimeout, err = durationFromEnv("PGWEB_CONNECT_TIMEOUT", cfg.ConnectTimeout); err != nil {
+		return Config{}, err
+	}
+	if cfg.CatalogTimeout, err = durationFromEnv("PGWEB_CATALOG_TIMEOUT", cfg.CatalogTimeout); err != nil {
+		return Config{}, err
+	}
+	if cfg.TableDataTimeout, err = durationFromEnv("PGWEB_TABLE_DATA_TIMEOUT", cfg.TableDataTimeout); err != nil {
+		return Config{}, err
+	}
+	if cfg.QueryTimeout, err = durationFromEnv("PGWEB_QUERY_TIMEOUT", cfg.QueryTimeout); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxQueryTimeout, err = durationFromEnv("PGWEB_MAX_QUERY_TIMEOUT", cfg.MaxQueryTimeout); err != nil {
+		return Config{}, err
+	}
+	if cfg.TransactionIdleTimeout, err = durationFromEnv("PGWEB_TRANSACTION_IDLE_TIMEOUT", cfg.TransactionIdleTimeout); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxResultRows, err = intFromEnv("PGWEB_MAX_RESULT_ROWS", cfg.MaxResultRows); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxStreamRows, err = intFromEnv("PGWEB_MAX_STREAM_ROWS", cfg.MaxStreamRows); err != nil {
+		return Config{}, err
+	}
+	if cfg.JobTimeout, err = durationFromEnv("PGWEB_JOB_TIMEOUT", cfg.JobTimeout); err != nil {
+		return Config{}, err
+	}
+	if cfg.JobRetention, err = durationFromEnv("PGWEB_JOB_RETENTION", cfg.JobRetention); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxJobRows, err = intFromEnv("PGWEB_MAX_JOB_ROWS", cfg.MaxJobRows); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxSessionJobs, err = intFromEnv("PGWEB_MAX_SESSION_JOBS", cfg.MaxSessionJobs); err != nil {
+		return Config{}, err
+	}
+	// Half the pool by default, leaving the rest for interactive queries and catalog reads.
+	if cfg.MaxRunningJobs, err = intFromEnv("PGWEB_MAX_RUNNING_JOBS", cfg.PoolMaxOpenConns/2); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxRunningJobs < 1 || cfg.MaxRunningJobs >= cfg.PoolMaxOpenConns {
+		return Config{}, fmt.Errorf("PGWEB_MAX_RUNNING_JOBS (%d) must be at least 1 and below PGWEB_POOL_MAX_OPEN_CONNS (%d)",
+			cfg.MaxRunningJobs, cfg.PoolMaxOpenConns)
+	}
+
+	return cfg, nil
+}
+
+// durationFromEnv parses a Go duration (e.g. "15m") from key, returning def when unset.
+func durationFromEnv(key string, def time.Duration) (time.Duration, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, raw, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be positive, got %q", key, raw)
+	}
+	return d, nil
+}
+
+// intFromEnv parses a positive integer from key, returning def when unset.
+func intFromEnv(key string, def int) (int, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, raw, err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("%s must be positive, got %q", key, raw)
+	}
+	return n, nil
+}
@@ -0,0 +1,52 @@
+package connection
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigRunningJobs(t *testing.T) {
+	tests := []struct {
+		name    string
+		pool    string
+		running string
+		want    int
+		wantErr bool
+	}{
+		{name: "defaults to half the pool", want: defaultPoolMaxOpenConns / 2},
+		{name: "follows the configured pool", pool: "20", want: 10},
+		{name: "explicit", running: "9", want: 9},
+		{name: "as large as the pool", running: "10", wantErr: true},
+		{name: "pool too small for jobs", pool: "1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PGWEB_POOL_MAX_OPEN_CONNS", tt.pool)
+			t.Setenv("PGWEB_MAX_RUNNING_JOBS", tt.running)
+			cfg, err := LoadConfig()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "PGWEB_MAX_RUNNING_JOBS") {
+					t.Errorf("LoadConfig error = %v, want one about PGWEB_MAX_RUNNING_JOBS", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.MaxRunningJobs != tt.want {
+				t.Errorf("MaxRunningJobs = %d, want %d", cfg.MaxRunningJobs, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	h := &ConnectionHandler{cfg: Config{ConnectTimeout: 10 * time.Second}}
+	if got := h.connectTimeout(Connection{}); got != 10*time.Second {
+		t.Errorf("connectTimeout without connect_timeout = %s, want the server default", got)
+	}
+	if got := h.connectTimeout(Connection{ConnectTimeout: 30}); got != 30*time.Second {
+		t.Errorf("connectTimeout with connect_timeout=30 = %s, want 30s", got)
+	}
+}
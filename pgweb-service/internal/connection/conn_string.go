@@ -0,0 +1,224 @@
+package connection
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+const defaultPort = 5432
+
+// expandURL parses c.URL (a postgres:// URL or a libpq key=value DSN) into c's fields.
+// Fields set explicitly alongside the URL take precedence over the ones parsed from it,
+// and URL is cleared so the password it may carry is never stored verbatim.
+func expandURL(c Connection) (Connection, error) {
+	if strings.TrimSpace(c.URL) == "" {
+		return c, nil
+	}
+
+	dsn := strings.TrimSpace(c.URL)
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		var err error
+		if dsn, err = pq.ParseURL(dsn); err != nil {
+			return Connection{}, fmt.Errorf("invalid url: %w", err)
+		}
+	}
+
+	params, err := parseDSN(dsn)
+	if err != nil {
+		return Connection{}, fmt.Errorf("invalid url: %w", err)
+	}
+
+	parsed, err := connectionFromParams(params)
+	if err != nil {
+		return Connection{}, fmt.Errorf("invalid url: %w", err)
+	}
+
+	overlayConnection(&parsed, c)
+	parsed.URL = ""
+	return parsed, nil
+}
+
+// connectionFromParams maps libpq parameter names onto Connection fields.
+func connectionFromParams(params map[string]string) (Connection, error) {
+	c := Connection{Port: defaultPort}
+	for key, value := range params {
+		switch key {
+		case "host":
+			c.Host = value
+		case "port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return Connection{}, fmt.Errorf("invalid port %q", value)
+			}
+			c.Port = IntValue(port)
+		case "user":
+			c.Username = value
+		case "password":
+			c.Password = value
+		case "dbname":
+			c.Database = value
+		case "sslmode":
+			c.SSLMode = SSLMode(value)
+		case "sslrootcert":
+			c.SSLRootCert = value
+		case "sslcert":
+			c.SSLCert = value
+		case "sslkey":
+			c.SSLKey = value
+		case "application_name":
+			c.ApplicationName = value
+		case "connect_timeout":
+			seconds, err := strconv.Atoi(value)
+			if err != nil {
+				return Connection{}, fmt.Errorf("invalid connect_timeout %q", value)
+			}
+			c.ConnectTimeout = IntValue(seconds)
+		case "options":
+			c.Options = value
+		case "target_session_attrs":
+			c.TargetSessionAttrs = value
+		default:
+			return Connection{}, fmt.Errorf("unsupported connection parameter %q", key)
+		}
+	}
+	return c, nil
+}
+
+// overlayConnection copies every non-zero field of explicit onto dst.
+func overlayConnection(dst *Connection, explicit Connection) {
+	if explicit.Host != "" {
+		dst.Host = explicit.Host
+	}
+	if explicit.Port != 0 {
+		dst.Port = explicit.Port
+	}
+	if explicit.Username != "" {
+		dst.Username = explicit.Username
+	}
+	if explicit.Password != "" {
+		dst.Password = explicit.Password
+	}
+	if explicit.Database != "" {
+		dst.Database = explicit.Database
+	}
+	if explicit.SSLMode != "" {
+		dst.SSLMode = explicit.SSLMode
+	}
+	if explicit.SSLRootCert != "" {
+		dst.SSLRootCert = explicit.SSLRootCert
+	}
+	if explicit.SSLCert != "" {
+		dst.SSLCert = explicit.SSLCert
+	}
+	if explicit.SSLKey != "" {
+		dst.SSLKey = explicit.SSLKey
+	}
+	if explicit.ApplicationName != "" {
+		dst.ApplicationName = explicit.ApplicationName
+	}
+	if explicit.ConnectTimeout != 0 {
+		dst.ConnectTimeout = explicit.ConnectTimeout
+	}
+	if explicit.Options != "" {
+		dst.Options = explicit.Options
+	}
+	if explicit.TargetSessionAttrs != "" {
+		dst.TargetSessionAttrs = explicit.TargetSessionAttrs
+	}
+	if explicit.StatementTimeout != 0 {
+		dst.StatementTimeout = explicit.StatementTimeout
+	}
+	if explicit.ReadOnly {
+		dst.ReadOnly = true
+	}
+	if explicit.SSH != nil {
+		dst.SSH = explicit.SSH
+	}
+	if explicit.Pool != (PoolSettings{}) {
+		dst.Pool = explicit.Pool
+	}
+}
+
+// parseDSN splits a libpq "key=value key='quoted value'" string into its parameters.
+func parseDSN(dsn string) (map[string]string, error) {
+	params := make(map[string]string)
+	r := []rune(dsn)
+	i := 0
+
+	skipSpace := func() {
+		for i < len(r) && unicode.IsSpace(r[i]) {
+			i++
+		}
+	}
+
+	for {
+		skipSpace()
+		if i >= len(r) {
+			return params, nil
+		}
+
+		start := i
+		for i < len(r) && r[i] != '=' && !unicode.IsSpace(r[i]) {
+			i++
+		}
+		key := string(r[start:i])
+		skipSpace()
+		if i >= len(r) || r[i] != '=' {
+			return nil, fmt.Errorf("missing \"=\" after %q", key)
+		}
+		if key == "" {
+			return nil, errors.New("missing parameter name before \"=\"")
+		}
+		i++
+		skipSpace()
+
+		var value strings.Builder
+		if i < len(r) && r[i] == '\'' {
+			i++
+			closed := false
+			for i < len(r) {
+				switch r[i] {
+				case '\\':
+					i++
+					if i < len(r) {
+						value.WriteRune(r[i])
+					}
+				case '\'':
+					closed = true
+				default:
+					value.WriteRune(r[i])
+				}
+				i++
+				if closed {
+					break
+				}
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated quoted value for %q", key)
+			}
+		} else {
+			for i < len(r) && !unicode.IsSpace(r[i]) {
+				if r[i] == '\\' && i+1 < len(r) {
+					i++
+				}
+				value.WriteRune(r[i])
+				i++
+			}
+		}
+
+		params[key] = value.String()
+	}
+}
+
+// quoteConnValue quotes a value for a libpq key=value string when it needs it.
+func quoteConnValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`+"\t\n\r") {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
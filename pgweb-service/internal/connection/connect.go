@@ -7,14 +7,17 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"pgweb-service/internal/util"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
-// SetConnectionAndConnect handles POST /connect and stores a new pool.
+// SetConnectionAndConnect handles POST /connect and stores a new pool in the caller's session.
 func (h *ConnectionHandler) SetConnectionAndConnect(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
 		http.Error(w, req.Method+" isn't allowed, only POST calls", http.StatusMethodNotAllowed)
@@ -28,53 +31,264 @@ func (h *ConnectionHandler) SetConnectionAndConnect(w http.ResponseWriter, req *
 		return
 	}
 
-	if err := validateConnection(conn); err != nil {
+	conn, err := expandURL(conn)
+	if err != nil {
 		http.Error(w, "Invalid connection parameters: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	db, err := sql.Open("postgres", conn.ToConnString())
+	if err := validateConnection(conn, h.cfg.CredentialsDir); err != nil {
+		http.Error(w, "Invalid connection parameters: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	db, res, err := openConnection(req.Context(), conn, h.cfg.CredentialsDir, h.connectTimeout(conn))
 	if err != nil {
-		log.Printf("Error opening database %s: %v", conn.Database, err)
-		http.Error(w, "Failed to open database connection: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error connecting to database %s: %v", conn.Database, err)
+		http.Error(w, "Failed to "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(req.Context(), 2*time.Second)
+	h.startSession(w, req, conn, "", db, res)
+}
+
+// poolResources are the files and tunnels that must live exactly as long as a session's pool.
+type poolResources struct {
+	tempDir string
+	tunnel  *sshTunnel
+	// connector opens connections like the pool's, but outside it.
+	connector *pq.Connector
+}
+
+// privateDir returns a 0700 temp directory for the pool's files, creating it on first use.
+func (r *poolResources) privateDir() (string, error) {
+	if r.tempDir == "" {
+		dir, err := os.MkdirTemp("", "pgweb-conn-*")
+		if err != nil {
+			return "", err
+		}
+		r.tempDir = dir
+	}
+	return r.tempDir, nil
+}
+
+func (r *poolResources) close() error {
+	if r == nil {
+		return nil
+	}
+
+	var err error
+	if r.tunnel != nil {
+		err = r.tunnel.Close()
+	}
+	if r.tempDir != "" {
+		if rmErr := os.RemoveAll(r.tempDir); err == nil {
+			err = rmErr
+		}
+	}
+	return err
+}
+
+// openConnection opens a pool for conn (through its SSH tunnel, if any) and verifies it with
+// a ping, trying each sslmode fallback in turn for allow/prefer; each attempt gets timeout.
+// Certificate and key files are looked up in the credentials directory credentialsDir.
+func openConnection(ctx context.Context, conn Connection, credentialsDir string, timeout time.Duration) (*sql.DB, *poolResources, error) {
+	res := &poolResources{}
+	conn, err := materializeSSL(conn, res, credentialsDir)
+	if err != nil {
+		res.close()
+		return nil, nil, fmt.Errorf("prepare ssl certificates: %w", err)
+	}
+
+	if conn.SSH != nil {
+		tunnel, err := dialSSHTunnel(ctx, *conn.SSH, res, credentialsDir)
+		if err != nil {
+			res.close()
+			return nil, nil, fmt.Errorf("open ssh tunnel: %w", err)
+		}
+		res.tunnel = tunnel
+	}
+
+	var lastErr error
+	for _, mode := range conn.SSLMode.attempts() {
+		attempt := conn
+		attempt.SSLMode = mode
+
+		db, connector, err := pingConnection(ctx, attempt, res.tunnel, timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		res.connector = connector
+		return db, res, nil
+	}
+
+	res.close()
+	return nil, nil, lastErr
+}
+
+func pingConnection(ctx context.Context, conn Connection, tunnel *sshTunnel, timeout time.Duration) (*sql.DB, *pq.Connector, error) {
+	connector, err := pq.NewConnector(conn.ToConnString())
+	if err != nil {
+		return nil, nil, fmt.Errorf("open database connection: %w", err)
+	}
+	if tunnel != nil {
+		connector.Dialer(tunnel)
+	}
+	db := sql.OpenDB(connector)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 	if err := db.PingContext(ctx); err != nil {
 		db.Close()
-		log.Printf("Error validating database %s: %v", conn.Database, err)
-		http.Error(w, "Failed to validate database connection: "+err.Error(), http.StatusInternalServerError)
+		return nil, nil, fmt.Errorf("validate database connection: %w", err)
+	}
+	if err := checkTargetSessionAttrs(ctx, db, conn.TargetSessionAttrs); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("validate database connection: %w", err)
+	}
+
+	return db, connector, nil
+}
+
+// connectTimeout is how long connecting to conn may take: its own connect_timeout, or
+// PGWEB_CONNECT_TIMEOUT.
+func (h *ConnectionHandler) connectTimeout(conn Connection) time.Duration {
+	if conn.ConnectTimeout > 0 {
+		return time.Duration(conn.ConnectTimeout) * time.Second
+	}
+	return h.cfg.ConnectTimeout
+}
+
+// checkTargetSessionAttrs emulates libpq's target_session_attrs, which lib/pq does not
+// implement, by asking the server for its role right after connecting.
+func checkTargetSessionAttrs(ctx context.Context, db *sql.DB, attrs string) error {
+	if attrs == "" || attrs == "any" || attrs == "prefer-standby" {
+		return nil
+	}
+
+	var readOnly, inRecovery bool
+	err := db.QueryRowContext(ctx, `
+		SELECT current_setting('transaction_read_only') = 'on', pg_is_in_recovery()
+	`).Scan(&readOnly, &inRecovery)
+	if err != nil {
+		return fmt.Errorf("check target_session_attrs: %w", err)
+	}
+
+	switch {
+	case attrs == "read-write" && readOnly:
+		return errors.New("server is read-only but target_session_attrs=read-write")
+	case attrs == "read-only" && !readOnly:
+		return errors.New("server is not read-only but target_session_attrs=read-only")
+	case attrs == "primary" && inRecovery:
+		return errors.New("server is a standby but target_session_attrs=primary")
+	case attrs == "standby" && !inRecovery:
+		return errors.New("server is not a standby but target_session_attrs=standby")
+	}
+	return nil
+}
+
+// startSession stores db under the caller's session (minting one if needed) and writes the response.
+func (h *ConnectionHandler) startSession(w http.ResponseWriter, req *http.Request, conn Connection, profile string, db *sql.DB, res *poolResources) {
+	h.configurePool(db, conn.Pool)
+
+	s, err := newSession(conn, profile, db, res)
+	if err != nil {
+		db.Close()
+		res.close()
+		http.Error(w, "Failed to create session: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Reconnecting with a live token swaps the pool behind that session instead of minting a new one.
 	h.mu.Lock()
-	if h.db != nil {
-		_ = h.db.Close()
+	previous := h.sessions[sessionID(req)]
+	if previous != nil {
+		delete(h.sessions, previous.id)
+		s.id = previous.id
+		s.historyID = previous.historyID
 	}
-	h.db = db
-	h.connection = conn
+	h.sessions[s.id] = s
 	h.mu.Unlock()
 
+	if previous != nil {
+		_ = previous.close()
+	}
+
+	writeSessionToken(w, s)
 	util.WriteJSON(w, http.StatusAccepted, map[string]any{
-		"message": fmt.Sprintf("Succesful connection to the database %s achived!", conn.Database),
+		"message":   fmt.Sprintf("Succesful connection to the database %s achived!", conn.Database),
+		"session":   s.id,
+		"profile":   profile,
+		"read_only": conn.ReadOnly,
+	})
+}
+
+// configurePool applies the server pool defaults, overridden by any per-connection settings.
+func (h *ConnectionHandler) configurePool(db *sql.DB, settings PoolSettings) {
+	maxOpen := h.cfg.PoolMaxOpenConns
+	if settings.MaxOpenConns > 0 {
+		maxOpen = settings.MaxOpenConns.Int()
+	}
+	maxIdle := h.cfg.PoolMaxIdleConns
+	if settings.MaxIdleConns > 0 {
+		maxIdle = settings.MaxIdleConns.Int()
+	}
+	lifetime := h.cfg.PoolConnMaxLifetime
+	if settings.ConnMaxLifetime > 0 {
+		lifetime = time.Duration(settings.ConnMaxLifetime) * time.Second
+	}
+	idleTime := h.cfg.PoolConnMaxIdleTime
+	if settings.ConnMaxIdleTime > 0 {
+		idleTime = time.Duration(settings.ConnMaxIdleTime) * time.Second
+	}
+
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxLifetime(lifetime)
+	db.SetConnMaxIdleTime(idleTime)
+}
+
+// ConnectionStats handles GET /connection/stats and reports the session pool's usage.
+func (h *ConnectionHandler) ConnectionStats(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "This endpoint accepts only GET calls", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, conn, ok := h.ensureDB(w, req)
+	if !ok {
+		return
+	}
+
+	stats := db.Stats()
+	util.WriteJSON(w, http.StatusOK, map[string]any{
+		"database":             conn.Database,
+		"max_open_connections": stats.MaxOpenConnections,
+		"open_connections":     stats.OpenConnections,
+		"in_use":               stats.InUse,
+		"idle":                 stats.Idle,
+		"wait_count":           stats.WaitCount,
+		"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+		"max_idle_closed":      stats.MaxIdleClosed,
+		"max_idle_time_closed": stats.MaxIdleTimeClosed,
+		"max_lifetime_closed":  stats.MaxLifetimeClosed,
 	})
 }
 
-// ValidateConnection handles GET /validate to ping the current pool.
+// ValidateConnection handles GET /validate to ping the session's pool.
 func (h *ConnectionHandler) ValidateConnection(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
 		http.Error(w, "This endpoint accepts only GET calls", http.StatusBadRequest)
 		return
 	}
 
-	db, conn, ok := h.ensureDB(w)
+	db, conn, ok := h.ensureDB(w, req)
 	if !ok {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(req.Context(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(req.Context(), h.connectTimeout(conn))
 	defer cancel()
 
 	if err := db.PingContext(ctx); err != nil {
@@ -83,53 +297,86 @@ func (h *ConnectionHandler) ValidateConnection(w http.ResponseWriter, req *http.
 	}
 
 	util.WriteJSON(w, http.StatusOK, map[string]any{
-		"message": fmt.Sprintf("Database %s connection is healthy", conn.Database),
+		"message":   fmt.Sprintf("Database %s connection is healthy", conn.Database),
+		"read_only": conn.ReadOnly,
 	})
 }
 
-// CloseConnection handles POST /close to tear down the pool.
+// CloseConnection handles POST /close to tear down the caller's session and pool.
 func (h *ConnectionHandler) CloseConnection(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
 		http.Error(w, "This endpoint accepts only POST calls", http.StatusBadRequest)
 		return
 	}
 
-	if _, _, ok := h.ensureDB(w); !ok {
+	s, ok := h.ensureSession(w, req)
+	if !ok {
 		return
 	}
 
 	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	if h.db == nil {
-		http.Error(w, "No active connection to close", http.StatusBadRequest)
-		return
-	}
+	delete(h.sessions, s.id)
+	h.mu.Unlock()
 
-	if err := h.db.Close(); err != nil {
+	if err := s.close(); err != nil {
 		http.Error(w, "Failed to close database connection: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	h.db = nil
-	h.connection = Connection{}
-
+	clearSessionToken(w)
 	util.WriteJSON(w, http.StatusOK, map[string]any{
 		"message": "Database connection closed successfully",
 	})
 }
 
+// ToConnString renders the connection as a libpq key=value string for lib/pq.
+// target_session_attrs is checked after connecting instead (see checkTargetSessionAttrs), and
+// allow/prefer must be resolved to a concrete mode first (see SSLMode.attempts).
 func (c Connection) ToConnString() string {
-	sslMode := "disable"
-	if c.SSLMode {
-		sslMode = "require"
+	sslMode := string(c.SSLMode.Effective())
+
+	parts := []string{
+		"host=" + quoteConnValue(c.Host),
+		"port=" + strconv.Itoa(int(c.Port)),
+		"dbname=" + quoteConnValue(c.Database),
+		"sslmode=" + sslMode,
+	}
+	// Leave credentials out when empty so lib/pq falls back to PGUSER/PGPASSWORD like libpq does.
+	if c.Username != "" {
+		parts = append(parts, "user="+quoteConnValue(c.Username))
+	}
+	if c.Password != "" {
+		parts = append(parts, "password="+quoteConnValue(c.Password))
+	}
+	if c.ApplicationName != "" {
+		parts = append(parts, "application_name="+quoteConnValue(c.ApplicationName))
+	}
+	if c.ConnectTimeout > 0 {
+		parts = append(parts, "connect_timeout="+strconv.Itoa(int(c.ConnectTimeout)))
+	}
+	if c.Options != "" {
+		parts = append(parts, "options="+quoteConnValue(c.Options))
+	}
+	if c.StatementTimeout > 0 {
+		parts = append(parts, "statement_timeout="+strconv.Itoa(int(c.StatementTimeout)))
+	}
+	if c.ReadOnly {
+		// lib/pq forwards unknown keys as startup parameters, so every pooled session starts read-only.
+		parts = append(parts, "default_transaction_read_only=on")
+	}
+	if c.SSLRootCert != "" {
+		parts = append(parts, "sslrootcert="+quoteConnValue(c.SSLRootCert))
+	}
+	if c.SSLCert != "" {
+		parts = append(parts, "sslcert="+quoteConnValue(c.SSLCert), "sslkey="+quoteConnValue(c.SSLKey))
 	}
 
-	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		c.Host, int(c.Port), c.Username, c.Password, c.Database, sslMode)
+	return strings.Join(parts, " ")
 }
 
-func validateConnection(c Connection) error {
+// validateConnection checks a connection payload; file paths in it must name files in the
+// credentials directory dir.
+func validateConnection(c Connection, dir string) error {
 	if c.Host == "" {
 		return errors.New("host is required")
 	}
@@ -139,5 +386,28 @@ func validateConnection(c Connection) error {
 	if c.Database == "" {
 		return errors.New("database is required")
 	}
+	if err := validateSSL(c, dir); err != nil {
+		return err
+	}
+	if err := validateSSH(c.SSH, dir); err != nil {
+		return err
+	}
+	if c.Pool.MaxOpenConns < 0 || c.Pool.MaxIdleConns < 0 || c.Pool.ConnMaxLifetime < 0 || c.Pool.ConnMaxIdleTime < 0 {
+		return errors.New("pool settings must be >= 0")
+	}
+	if c.Pool.MaxOpenConns > 0 && c.Pool.MaxIdleConns > c.Pool.MaxOpenConns {
+		return errors.New("pool.max_idle_conns cannot exceed pool.max_open_conns")
+	}
+	if int(c.StatementTimeout) < 0 {
+		return errors.New("statement_timeout_ms must be >= 0")
+	}
+	if int(c.ConnectTimeout) < 0 {
+		return errors.New("connect_timeout must be >= 0")
+	}
+	switch c.TargetSessionAttrs {
+	case "", "any", "read-write", "read-only", "primary", "standby", "prefer-standby":
+	default:
+		return fmt.Errorf("unsupported target_session_attrs %q", c.TargetSessionAttrs)
+	}
 	return nil
 }
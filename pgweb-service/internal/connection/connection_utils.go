@@ -1,21 +1,79 @@
 package connection
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
+
+	"pgweb-service/internal/util"
 )
 
-// ensureDB returns the current DB pool and connection info, or writes an error response.
-func (h *ConnectionHandler) ensureDB(w http.ResponseWriter) (*sql.DB, Connection, bool) {
+// ensureDB returns the caller's DB pool and connection info, or writes an error response.
+func (h *ConnectionHandler) ensureDB(w http.ResponseWriter, req *http.Request) (*sql.DB, Connection, bool) {
+	s, ok := h.ensureSession(w, req)
+	if !ok {
+		return nil, Connection{}, false
+	}
+
+	return s.db, s.connection, true
+}
+
+// ensureSession resolves the session named by the request token, or writes an error response.
+func (h *ConnectionHandler) ensureSession(w http.ResponseWriter, req *http.Request) (*session, bool) {
+	id := sessionID(req)
+
 	h.mu.RLock()
-	db := h.db
-	conn := h.connection
+	s := h.sessions[id]
 	h.mu.RUnlock()
 
-	if db == nil {
+	if id == "" || s == nil {
 		http.Error(w, "No active connection. Call POST /connect first", http.StatusBadRequest)
-		return nil, Connection{}, false
+		return nil, false
+	}
+
+	s.touch()
+	return s, true
+}
+
+// writeReadOnlyError rejects a write attempted through a read-only connection.
+func writeReadOnlyError(w http.ResponseWriter) {
+	util.WriteJSON(w, http.StatusForbidden, map[string]any{
+		"error":     "This connection is read-only; only SELECT, WITH, VALUES, TABLE, SHOW and EXPLAIN statements are allowed",
+		"read_only": true,
+	})
+}
+
+// randomID returns n random bytes hex-encoded, for session tokens and resource IDs.
+func randomID(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// writeFileAtomic replaces the store file at path with data via a 0600 temp file in the same
+// directory, so a crash never leaves a truncated file. what names the file in errors.
+func writeFileAtomic(path, what string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+what+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s file: %w", what, err)
 	}
+	defer os.Remove(tmp.Name())
 
-	return db, conn, true
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s file: %w", what, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s file: %w", what, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s file: %w", what, err)
+	}
+	return nil
 }
@@ -0,0 +1,134 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"pgweb-service/internal/sqlparse"
+)
+
+// taggedRows is implemented by lib/pq's rows. database/sql hides the command tag, so
+// statements are executed against the driver connection directly.
+type taggedRows interface {
+	driver.Rows
+	Tag() string
+	Result() driver.Result
+}
+
+// errStopRows is returned by a consume func that has read all the rows it wants. The rest of
+// the result is cancelled or discarded unread so the connection stays usable for the next
+// statement.
+var errStopRows = errors.New("stop reading rows")
+
+// execResult describes a completed statement. Truncated is set when consume stopped early;
+// Tag and RowsAffected then still describe the full statement, unless it was interrupted
+// and never completed, which leaves them empty.
+type execResult struct {
+	Tag          string
+	RowsAffected int64
+	Truncated    bool
+}
+
+// execStatement sends query to the server exactly once. When the statement returns a row
+// description, consume is handed the driver rows before they are drained; statements
+// without columns skip it. The full command tag (e.g. "INSERT 0 3") and affected-row
+// count are read once the server has completed the statement.
+//
+// When consume stops early, the server would otherwise go on producing every remaining row
+// just for them to be drained. For read-only statements execStatement calls interrupt, if
+// given, to cancel the statement instead, and takes the resulting query_canceled error as a
+// normal end. Callers pass a nil interrupt inside explicit transactions, which a cancelled
+// statement would abort; statements that may write are always run to completion.
+func execStatement(ctx context.Context, qc *sql.Conn, query string, args []any, interrupt func() error, consume func(driver.Rows) error) (execResult, error) {
+	named, err := namedValues(args)
+	if err != nil {
+		return execResult{}, err
+	}
+
+	var res execResult
+	err = qc.Raw(func(dc any) error {
+		queryer, ok := dc.(driver.QueryerContext)
+		if !ok {
+			return errors.New("driver does not support direct queries")
+		}
+
+		rows, err := queryer.QueryContext(ctx, query, named)
+		if err != nil {
+			return err
+		}
+		tagged, ok := rows.(taggedRows)
+		if !ok {
+			rows.Close()
+			return errors.New("driver does not report command tags")
+		}
+
+		interrupted := false
+		if len(rows.Columns()) > 0 && consume != nil {
+			if err := consume(rows); err != nil {
+				if !errors.Is(err, errStopRows) {
+					rows.Close()
+					return err
+				}
+				res.Truncated = true
+				interrupted = interruptRead(query, interrupt)
+			}
+		}
+		// Close drains any remaining messages, including the CommandComplete carrying the tag.
+		if err := rows.Close(); err != nil {
+			if interrupted && queryCanceled(err) {
+				return nil
+			}
+			return err
+		}
+
+		res.RowsAffected, _ = tagged.Result().RowsAffected()
+		res.Tag = commandTag(tagged.Tag(), res.RowsAffected)
+		return nil
+	})
+	return res, err
+}
+
+// interruptRead cancels a truncated read-only statement through interrupt, reporting whether
+// the cancel request was sent. The statement may still complete before it arrives.
+func interruptRead(query string, interrupt func() error) bool {
+	if interrupt == nil {
+		return false
+	}
+	if readOnly, err := sqlparse.IsReadOnly(query); err != nil || !readOnly {
+		return false
+	}
+	if err := interrupt(); err != nil {
+		log.Printf("Draining truncated result after failed cancel: %v", err)
+		return false
+	}
+	return true
+}
+
+// commandTag rebuilds the tag the server sent; lib/pq strips the row count from it.
+func commandTag(tag string, affected int64) string {
+	switch tag {
+	case "INSERT":
+		return "INSERT 0 " + strconv.FormatInt(affected, 10)
+	case "SELECT", "UPDATE", "DELETE", "FETCH", "MOVE", "COPY":
+		return tag + " " + strconv.FormatInt(affected, 10)
+	default:
+		return tag
+	}
+}
+
+func namedValues(args []any) ([]driver.NamedValue, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			return nil, fmt.Errorf("param $%d: %w", i+1, err)
+		}
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named, nil
+}
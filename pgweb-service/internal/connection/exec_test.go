@@ -0,0 +1,38 @@
+package connection
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInterruptRead(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		err        error
+		wantCalled bool
+		want       bool
+	}{
+		{"read", "SELECT * FROM big", nil, true, true},
+		{"failed cancel drains", "SELECT * FROM big", errors.New("no connection"), true, false},
+		{"write with RETURNING", "UPDATE big SET x = 1 RETURNING *", nil, false, false},
+		{"data-modifying CTE", "WITH d AS (DELETE FROM big RETURNING *) SELECT * FROM d", nil, false, false},
+		{"unparsable", "SELECT 'unterminated", nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			got := interruptRead(tt.query, func() error {
+				called = true
+				return tt.err
+			})
+			if called != tt.wantCalled || got != tt.want {
+				t.Errorf("interruptRead(%q) = %v, called %v; want %v, called %v", tt.query, got, called, tt.want, tt.wantCalled)
+			}
+		})
+	}
+
+	if interruptRead("SELECT 1", nil) {
+		t.Error("interruptRead without an interrupt reported a cancel")
+	}
+}
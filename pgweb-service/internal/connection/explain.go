@@ -0,0 +1,248 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"pgweb-service/internal/plan"
+	"pgweb-service/internal/sqlparse"
+	"pgweb-service/internal/util"
+
+	"github.com/lib/pq"
+)
+
+// explainOptions are the EXPLAIN options a caller may switch on. FORMAT JSON is always used.
+type explainOptions struct {
+	Analyze  BoolValue `json:"analyze"`
+	Buffers  BoolValue `json:"buffers"`
+	Verbose  BoolValue `json:"verbose"`
+	Settings BoolValue `json:"settings"`
+}
+
+// statement wraps query in EXPLAIN with the chosen options.
+func (o explainOptions) statement(query string) string {
+	opts := []string{"FORMAT JSON"}
+	for _, opt := range []struct {
+		name string
+		on   BoolValue
+	}{
+		{"ANALYZE", o.Analyze},
+		{"BUFFERS", o.Buffers},
+		{"VERBOSE", o.Verbose},
+		{"SETTINGS", o.Settings},
+	} {
+		if opt.on {
+			opts = append(opts, opt.name)
+		}
+	}
+	return "EXPLAIN (" + strings.Join(opts, ", ") + ") " + query
+}
+
+// Explain handles POST /explain. It plans a single statement (given without EXPLAIN) and
+// returns the parsed plan tree. With "analyze": true the statement really runs, always inside
+// a transaction that is rolled back afterwards, so writes leave no trace.
+func (h *ConnectionHandler) Explain(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "This endpoint accepts only POST calls", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, ok := h.ensureSession(w, req)
+	if !ok {
+		return
+	}
+	conn := s.connection
+
+	var payload struct {
+		Query     string   `json:"query"`
+		Params    []any    `json:"params"`
+		TimeoutMS IntValue `json:"timeout_ms"`
+		explainOptions
+	}
+	dec := util.DecodeJsonBody(req)
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		http.Error(w, "Failed to decode request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	statements, err := sqlparse.Split(payload.Query)
+	if err != nil {
+		http.Error(w, "Failed parsing query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(statements) != 1 {
+		http.Error(w, "query must contain exactly one statement", http.StatusBadRequest)
+		return
+	}
+	query := statements[0].Text
+	if first := statements[0].Tokens[0]; first.Kind == sqlparse.Word && first.Value == "explain" {
+		http.Error(w, "send the statement without EXPLAIN; use the analyze, buffers, verbose and settings options", http.StatusBadRequest)
+		return
+	}
+
+	args, err := bindParams(query, payload.Params)
+	if err != nil {
+		http.Error(w, "Invalid params: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Plain EXPLAIN never executes the statement, so only ANALYZE needs the read-only check.
+	if conn.ReadOnly && payload.Analyze {
+		if !allowReadOnly(w, query) {
+			return
+		}
+	}
+
+	timeout, err := h.resolveTimeout(payload.TimeoutMS.Int(), conn, h.cfg.QueryTimeout)
+	if err != nil {
+		http.Error(w, "Invalid timeout: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	qc, release, err := acquireQueryConn(ctx, s.db, timeout)
+	if err != nil {
+		http.Error(w, "Failed to acquire a connection: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer release()
+
+	pid, err := backendPID(ctx, qc)
+	if err != nil {
+		http.Error(w, "Failed to identify the backend: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	running, unregister, err := s.running.register(pid, query, cancel)
+	if err != nil {
+		http.Error(w, "Failed to register the query: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer unregister()
+	w.Header().Set("X-Pgweb-Query-Id", running.ID)
+
+	raw, err := runExplain(ctx, qc, payload.explainOptions.statement(query), args, bool(payload.Analyze))
+	if err != nil {
+		http.Error(w, "Failed to explain query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	explain, err := plan.Parse(raw)
+	if err != nil {
+		http.Error(w, "Failed to read the plan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Hints still come out without the catalog, just without table sizes and index checks.
+	relations, err := planRelations(ctx, qc, s.db, explain)
+	if err != nil {
+		log.Printf("Error looking up plan relations: %v", err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{
+		"query":       query,
+		"options":     payload.explainOptions,
+		"rolled_back": bool(payload.Analyze),
+		"explain":     explain,
+		"findings":    plan.Hints(explain, relations),
+	})
+}
+
+// planRelations looks up the size, columns and indexes of every table the plan reads. Without
+// VERBOSE, EXPLAIN leaves out schemas; they are filled into the plan by resolving each name
+// through qc's search_path, as the statement itself did. Tables that no longer exist, such as
+// ones created by a rolled-back ANALYZE, are skipped.
+func planRelations(ctx context.Context, qc *sql.Conn, db *sql.DB, explain *plan.Explain) (map[plan.RelationKey]plan.Relation, error) {
+	relations := make(map[plan.RelationKey]plan.Relation)
+
+	schemas := make(map[string]string)
+	for _, key := range explain.Relations() {
+		if key.Schema != "" {
+			continue
+		}
+		var schemaName sql.NullString
+		err := qc.QueryRowContext(ctx, `
+			SELECT n.nspname
+			FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE c.oid = to_regclass($1)
+		`, pq.QuoteIdentifier(key.Name)).Scan(&schemaName)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return relations, err
+		}
+		schemas[key.Name] = schemaName.String
+	}
+	explain.Plan.Walk(func(n *plan.Node) {
+		if n.Relation != "" && n.Schema == "" {
+			n.Schema = schemas[n.Relation]
+		}
+	})
+
+	indexes := make(map[string][]schemaIndex)
+	for _, key := range explain.Relations() {
+		if key.Schema == "" {
+			continue
+		}
+
+		columns, err := tableColumns(ctx, db, key.Schema, key.Name)
+		if errors.Is(err, errTableNotFound) {
+			continue
+		}
+		if err != nil {
+			return relations, err
+		}
+		rel := plan.Relation{Columns: make([]string, len(columns))}
+		for i, c := range columns {
+			rel.Columns[i] = c.Name
+		}
+
+		err = db.QueryRowContext(ctx, `
+			SELECT c.reltuples
+			FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = $1 AND c.relname = $2
+		`, key.Schema, key.Name).Scan(&rel.Rows)
+		if err != nil {
+			return relations, err
+		}
+
+		list, ok := indexes[key.Schema]
+		if !ok {
+			if list, err = schemaIndexes(ctx, db, key.Schema); err != nil {
+				return relations, err
+			}
+			indexes[key.Schema] = list
+		}
+		for _, idx := range list {
+			if idx.Table == key.Name {
+				rel.Indexes = append(rel.Indexes, idx.Columns)
+			}
+		}
+
+		relations[key] = rel
+	}
+	return relations, nil
+}
+
+// runExplain runs an EXPLAIN statement and returns its JSON output. When the statement
+// executes the query it runs in a transaction that is always rolled back.
+func runExplain(ctx context.Context, qc *sql.Conn, statement string, args []any, rollback bool) ([]byte, error) {
+	var raw []byte
+	if !rollback {
+		err := qc.QueryRowContext(ctx, statement, args...).Scan(&raw)
+		return raw, err
+	}
+
+	tx, err := qc.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, statement, args...).Scan(&raw)
+	return raw, err
+}
@@ -1,30 +1,74 @@
 package connection
 
 import (
-	"database/sql"
 	"net/http"
 	"sync"
 )
 
-// ConnectionHandler stores configuration and state for DB-related endpoints.
+// ConnectionHandler stores configuration and per-client sessions for DB-related endpoints.
 type ConnectionHandler struct {
-	mu         sync.RWMutex
-	connection Connection
-	db         *sql.DB
+	cfg      Config
+	profiles *ProfileStore
+	history  *HistoryStore
+	snippets *SnippetStore
+	mu       sync.RWMutex
+	sessions map[string]*session
 }
 
 type Connection struct {
+	// URL optionally carries a postgres:// URL or libpq key=value DSN; see expandURL.
+	URL      string   `json:"url,omitempty"`
 	Host     string   `json:"host"`
 	Port     IntValue `json:"port"`
 	Username string   `json:"username"`
 	Password string   `json:"password"`
 	Database string   `json:"database"`
-	SSLMode  bool     `json:"ssl_mode"`
+	SSLMode  SSLMode  `json:"ssl_mode"`
+
+	// SSL certificate material: inline PEM content or the name of a file in the server's
+	// credentials directory (Config.CredentialsDir).
+	SSLRootCert string `json:"ssl_root_cert,omitempty"`
+	SSLCert     string `json:"ssl_cert,omitempty"`
+	SSLKey      string `json:"ssl_key,omitempty"`
+
+	ApplicationName    string   `json:"application_name,omitempty"`
+	ConnectTimeout     IntValue `json:"connect_timeout,omitempty"` // seconds
+	Options            string   `json:"options,omitempty"`
+	TargetSessionAttrs string   `json:"target_session_attrs,omitempty"`
+
+	// StatementTimeout (milliseconds) is sent as the session's statement_timeout and is the
+	// default deadline for requests on this connection.
+	StatementTimeout IntValue `json:"statement_timeout_ms,omitempty"`
+
+	// ReadOnly makes every pooled session default to read-only transactions and limits
+	// /query to statements that only read.
+	ReadOnly BoolValue `json:"read_only,omitempty"`
+
+	// SSH, when set, makes every pooled connection dial Postgres through this bastion host.
+	SSH *SSHTunnel `json:"ssh,omitempty"`
+
+	Pool PoolSettings `json:"pool"`
+}
+
+// PoolSettings tunes a session's database/sql pool; zero values fall back to the server defaults.
+type PoolSettings struct {
+	MaxOpenConns    IntValue `json:"max_open_conns,omitempty"`
+	MaxIdleConns    IntValue `json:"max_idle_conns,omitempty"`
+	ConnMaxLifetime IntValue `json:"conn_max_lifetime_seconds,omitempty"`
+	ConnMaxIdleTime IntValue `json:"conn_max_idle_time_seconds,omitempty"`
 }
 
-// NewConnectionHandler creates a handler with no active DB pool.
-func NewConnectionHandler() *ConnectionHandler {
-	return &ConnectionHandler{}
+// NewConnectionHandler creates a handler with no active sessions and starts the idle session reaper.
+func NewConnectionHandler(cfg Config, profiles *ProfileStore, history *HistoryStore, snippets *SnippetStore) *ConnectionHandler {
+	h := &ConnectionHandler{
+		cfg:      cfg,
+		profiles: profiles,
+		history:  history,
+		snippets: snippets,
+		sessions: make(map[string]*session),
+	}
+	go h.reapIdleSessions()
+	return h
 }
 
 // Register wires HTTP endpoints to the mux.
@@ -32,11 +76,29 @@ func (h *ConnectionHandler) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/connect", h.SetConnectionAndConnect)
 	mux.HandleFunc("/validate", h.ValidateConnection)
 	mux.HandleFunc("/close", h.CloseConnection)
+	mux.HandleFunc("/connection/stats", h.ConnectionStats)
+	mux.HandleFunc("/profiles", h.Profiles)
+	mux.HandleFunc("/profiles/{name}", h.Profile)
+	mux.HandleFunc("/profiles/{name}/connect", h.ConnectProfile)
 	mux.HandleFunc("/schemas", h.ListSchemas)
 	mux.HandleFunc("/schemas/{schema}/tables", h.ListTablesForSchema)
 	mux.HandleFunc("/schemas/{schema}/tables/{table}/columns", h.ListTableColumns)
 	mux.HandleFunc("/schemas/{schema}/tables/{table}/data", h.ListTableData)
+	mux.HandleFunc("/schemas/{schema}/tables/{table}/rows", h.TableRows)
+	mux.HandleFunc("/rows/batch", h.BatchRows)
 	mux.HandleFunc("/schemas/{schema}/views", h.ListViewsForSchema)
 	mux.HandleFunc("/schemas/{schema}/indexes", h.ListIndexesForSchema)
 	mux.HandleFunc("/query", h.ExecuteQuery)
+	mux.HandleFunc("/query/jobs", h.QueryJobs)
+	mux.HandleFunc("/query/jobs/{id}", h.QueryJob)
+	mux.HandleFunc("/explain", h.Explain)
+	mux.HandleFunc("/queries/running", h.ListRunningQueries)
+	mux.HandleFunc("/queries/{id}/cancel", h.CancelQuery)
+	mux.HandleFunc("/transactions", h.Transactions)
+	mux.HandleFunc("/transactions/{id}/{action}", h.TransactionAction)
+	mux.HandleFunc("/history", h.History)
+	mux.HandleFunc("/history/{id}", h.HistoryEntry)
+	mux.HandleFunc("/history/{id}/rerun", h.RerunHistory)
+	mux.HandleFunc("/snippets", h.Snippets)
+	mux.HandleFunc("/snippets/{name}", h.Snippet)
 }
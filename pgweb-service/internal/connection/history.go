@@ -0,0 +1,219 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pgweb-service/internal/util"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// recordHistory fills in where e ran and stores it. Failing to record never fails the query.
+func (h *ConnectionHandler) recordHistory(s *session, e HistoryEntry) {
+	e.Profile = s.profile
+	e.Host = s.connection.Host
+	e.Database = s.connection.Database
+	e.Username = s.connection.Username
+	e.Session = s.historyID
+	if err := h.history.Add(e); err != nil {
+		log.Printf("Error recording query history: %v", err)
+	}
+}
+
+// historyRows is the row count recorded for a statement: rows returned when it has a result
+// set, rows affected otherwise.
+func historyRows(columns []util.Column, returned int, affected int64) int64 {
+	if columns != nil {
+		return int64(returned)
+	}
+	return affected
+}
+
+// viewHistory returns e as s may see it: params stay with the session that ran the statement.
+func viewHistory(s *session, e HistoryEntry) HistoryEntry {
+	if e.Session != s.historyID && len(e.Params) > 0 {
+		e.Params = nil
+		e.ParamsRedacted = true
+	}
+	return e
+}
+
+// History handles GET /history, a newest-first search over the statements the caller's session
+// may see (its own, and those of its profile):
+//
+//	q=orders          substring of the query, case-insensitive
+//	profile=prod      statements run through a stored profile
+//	session=current   statements run by the caller's session (or another session's history ID)
+//	status=ok|error
+//	since=2024-05-01T00:00:00Z&until=...
+//	limit=50&offset=0
+func (h *ConnectionHandler) History(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "This endpoint accepts only GET calls", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, ok := h.ensureSession(w, req)
+	if !ok {
+		return
+	}
+
+	params := req.URL.Query()
+	filter := HistoryFilter{
+		Text:    params.Get("q"),
+		Profile: params.Get("profile"),
+		Session: params.Get("session"),
+
+		ViewerSession: s.historyID,
+		ViewerProfile: s.profile,
+	}
+	if filter.Session == "current" {
+		filter.Session = s.historyID
+	}
+
+	switch status := params.Get("status"); status {
+	case "":
+	case "ok", "error":
+		failed := status == "error"
+		filter.Failed = &failed
+	default:
+		http.Error(w, "status must be ok or error", http.StatusBadRequest)
+		return
+	}
+
+	for key, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		v := params.Get(key)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, key+" must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		*t = parsed
+	}
+
+	limit, offset := defaultHistoryLimit, 0
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxHistoryLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxHistoryLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	if v := params.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	entries, total := h.history.Search(filter, offset, limit)
+	for i := range entries {
+		entries[i] = viewHistory(s, entries[i])
+	}
+	util.WriteJSON(w, http.StatusOK, map[string]any{
+		"entries":  entries,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+		"has_more": offset+len(entries) < total,
+	})
+}
+
+// historyEntry looks up the entry named in the path, answering 404 for entries the caller's
+// session may not see, as for missing ones.
+func (h *ConnectionHandler) historyEntry(w http.ResponseWriter, req *http.Request, s *session) (HistoryEntry, bool) {
+	e, ok := h.history.Get(req.PathValue("id"))
+	if !ok || !historyVisible(e, s.historyID, s.profile) {
+		http.Error(w, "History entry not found", http.StatusNotFound)
+		return HistoryEntry{}, false
+	}
+	return e, true
+}
+
+// HistoryEntry handles GET /history/{id}.
+func (h *ConnectionHandler) HistoryEntry(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "This endpoint accepts only GET calls", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, ok := h.ensureSession(w, req)
+	if !ok {
+		return
+	}
+	e, ok := h.historyEntry(w, req, s)
+	if !ok {
+		return
+	}
+	util.WriteJSON(w, http.StatusOK, viewHistory(s, e))
+}
+
+// RerunHistory handles POST /history/{id}/rerun: the entry's statement and params go through
+// /query again on the caller's current session, which need not be the one that first ran it.
+// The optional body takes the /query options timeout_ms, max_rows, transaction_id and confirm.
+// Entries with params can only be re-run by the session that ran them, since running them
+// elsewhere would expose the params through the result.
+func (h *ConnectionHandler) RerunHistory(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "This endpoint accepts only POST calls", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, ok := h.ensureSession(w, req)
+	if !ok {
+		return
+	}
+	e, ok := h.historyEntry(w, req, s)
+	if !ok {
+		return
+	}
+	if viewHistory(s, e).ParamsRedacted {
+		http.Error(w, "This entry's params belong to another session; run the query through /query with your own params", http.StatusForbidden)
+		return
+	}
+
+	type options struct {
+		TimeoutMS     IntValue  `json:"timeout_ms,omitempty"`
+		MaxRows       IntValue  `json:"max_rows,omitempty"`
+		TransactionID string    `json:"transaction_id,omitempty"`
+		Confirm       BoolValue `json:"confirm,omitempty"`
+	}
+	var payload options
+	// The body is optional.
+	if err := util.DecodeJsonBody(req).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Failed to decode request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := json.Marshal(struct {
+		Query  string `json:"query"`
+		Params []any  `json:"params,omitempty"`
+		options
+	}{e.Query, e.Params, payload})
+	if err != nil {
+		http.Error(w, "Failed to prepare the query: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rerun := req.Clone(req.Context())
+	rerun.Body = io.NopCloser(bytes.NewReader(body))
+	rerun.ContentLength = int64(len(body))
+	h.ExecuteQuery(w, rerun)
+}
@@ -0,0 +1,216 @@
+package connection
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HistoryEntry records one statement executed through /query or a query job.
+type HistoryEntry struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+
+	// Where it ran: the profile (empty for ad-hoc connections), the target database and the
+	// session's history ID, which is not its token.
+	Profile  string `json:"profile,omitempty"`
+	Host     string `json:"host"`
+	Database string `json:"database"`
+	Username string `json:"username"`
+	Session  string `json:"session"`
+
+	Query          string `json:"query"`
+	Params         []any  `json:"params,omitempty"`
+	ParamsRedacted bool   `json:"params_redacted,omitempty"` // params withheld from another session
+	Snippet        string `json:"snippet,omitempty"`         // the snippet the query was expanded from
+	Source         string `json:"source"`                    // query, script, stream or job
+	TransactionID  string `json:"transaction_id,omitempty"`
+
+	DurationMS int64 `json:"duration_ms"`
+	// Rows is the number of rows returned, or affected for statements without a result set.
+	Rows       int64  `json:"rows"`
+	CommandTag string `json:"command_tag,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// HistoryFilter narrows a history search. Zero fields match everything.
+type HistoryFilter struct {
+	Text    string // case-insensitive substring of the query
+	Profile string
+	Session string
+	Failed  *bool
+	Since   time.Time
+	Until   time.Time
+
+	// ViewerSession and ViewerProfile limit the search to what a session may see; see
+	// historyVisible. Empty ViewerSession means no limit.
+	ViewerSession string
+	ViewerProfile string
+}
+
+// historyVisible reports whether the session with history ID session, opened from profile
+// (empty for ad-hoc connections), may see e: its own entries and the entries of its profile.
+func historyVisible(e HistoryEntry, session, profile string) bool {
+	return e.Session == session || (profile != "" && e.Profile == profile)
+}
+
+func (f HistoryFilter) match(e HistoryEntry) bool {
+	switch {
+	case f.Text != "" && !strings.Contains(strings.ToLower(e.Query), strings.ToLower(f.Text)):
+		return false
+	case f.Profile != "" && e.Profile != f.Profile:
+		return false
+	case f.Session != "" && e.Session != f.Session:
+		return false
+	case f.Failed != nil && *f.Failed != (e.Error != ""):
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	case f.ViewerSession != "" && !historyVisible(e, f.ViewerSession, f.ViewerProfile):
+		return false
+	}
+	return true
+}
+
+// HistoryStore keeps executed statements in a local append-only JSON Lines file, oldest first,
+// holding on to at most maxEntries of them.
+type HistoryStore struct {
+	path       string
+	maxEntries int
+	mu         sync.Mutex
+	entries    []HistoryEntry
+}
+
+// OpenHistoryStore loads the history from path; a missing file is treated as an empty
+// history. Lines that can't be parsed, such as one torn by a crash mid-write, are skipped.
+func OpenHistoryStore(path string, maxEntries int) (*HistoryStore, error) {
+	s := &HistoryStore{path: path, maxEntries: maxEntries}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(nil, len(raw)+1)
+	skipped := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var e HistoryEntry
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		if err := dec.Decode(&e); err != nil {
+			skipped++
+			continue
+		}
+		s.entries = append(s.entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse history file %s: %w", path, err)
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d unreadable entries in history file %s", skipped, path)
+	}
+	if len(s.entries) > maxEntries {
+		s.entries = s.entries[len(s.entries)-maxEntries:]
+	}
+
+	return s, nil
+}
+
+// Add assigns the entry an ID and appends it to the history.
+func (s *HistoryStore) Add(e HistoryEntry) error {
+	id, err := randomID(8)
+	if err != nil {
+		return err
+	}
+	e.ID = id
+
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, e)
+	// Rewrite the file only once it has grown a tenth past the cap, so that trimming the
+	// oldest entries doesn't cost a full rewrite on every statement.
+	if len(s.entries) > s.maxEntries+s.maxEntries/10 {
+		s.entries = append([]HistoryEntry(nil), s.entries[len(s.entries)-s.maxEntries:]...)
+		return s.rewriteLocked()
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	if _, err := f.Write(append(raw, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	return f.Close()
+}
+
+// Get looks up a single entry by ID.
+func (s *HistoryStore) Get(id string) (HistoryEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		if s.entries[i].ID == id {
+			return s.entries[i], true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+// Search returns up to limit entries matching f, newest first, after skipping offset of them,
+// along with the total number of matches.
+func (s *HistoryStore) Search(f HistoryFilter, offset, limit int) ([]HistoryEntry, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	page := make([]HistoryEntry, 0, limit)
+	total := 0
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		if !f.match(s.entries[i]) {
+			continue
+		}
+		if total >= offset && len(page) < limit {
+			page = append(page, s.entries[i])
+		}
+		total++
+	}
+	return page, total
+}
+
+// rewriteLocked writes the whole history atomically.
+func (s *HistoryStore) rewriteLocked() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range s.entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	return writeFileAtomic(s.path, "history", buf.Bytes())
+}
@@ -0,0 +1,154 @@
+package connection
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// newHistoryFixture sets up a handler with three sessions — two opened from profile "prod",
+// one ad hoc — each of which has run one statement with a param.
+func newHistoryFixture(t *testing.T) (h *ConnectionHandler, prodA, prodB, adhoc *session, ids map[*session]string) {
+	t.Helper()
+	store, err := OpenHistoryStore(filepath.Join(t.TempDir(), "history.jsonl"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h = &ConnectionHandler{history: store, sessions: make(map[string]*session)}
+
+	ids = make(map[*session]string)
+	open := func(profile string) *session {
+		s, err := newSession(Connection{Host: "db", Database: "app"}, profile, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.sessions[s.id] = s
+		h.recordHistory(s, HistoryEntry{Query: "SELECT $1", Params: []any{"secret-" + profile + s.historyID}, Source: "query"})
+		entries, _ := store.Search(HistoryFilter{Session: s.historyID}, 0, 1)
+		ids[s] = entries[0].ID
+		return s
+	}
+	return h, open("prod"), open("prod"), open(""), ids
+}
+
+func historyRequest(t *testing.T, h *ConnectionHandler, handler http.HandlerFunc, method, target, id string, s *session) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	if id != "" {
+		req.SetPathValue("id", id)
+	}
+	if s != nil {
+		req.Header.Set(sessionHeaderName, s.id)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestHistoryRequiresSession(t *testing.T) {
+	h, prodA, _, _, ids := newHistoryFixture(t)
+	for name, handler := range map[string]http.HandlerFunc{
+		"search": h.History,
+		"entry":  h.HistoryEntry,
+		"rerun":  h.RerunHistory,
+	} {
+		method := http.MethodGet
+		if name == "rerun" {
+			method = http.MethodPost
+		}
+		rec := historyRequest(t, h, handler, method, "/history", ids[prodA], nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s without a session = %d, want 400", name, rec.Code)
+		}
+	}
+}
+
+func TestHistorySearchScope(t *testing.T) {
+	h, prodA, prodB, adhoc, ids := newHistoryFixture(t)
+
+	search := func(s *session, query string) []HistoryEntry {
+		t.Helper()
+		rec := historyRequest(t, h, h.History, http.MethodGet, "/history"+query, "", s)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /history%s = %d %s", query, rec.Code, rec.Body)
+		}
+		var body struct{ Entries []HistoryEntry }
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Entries
+	}
+
+	// A profile session sees its own entry with params and its sibling's without.
+	entries := search(prodA, "")
+	if len(entries) != 2 {
+		t.Fatalf("prod session sees %d entries, want 2", len(entries))
+	}
+	for _, e := range entries {
+		own := e.ID == ids[prodA]
+		if !own && e.ID != ids[prodB] {
+			t.Errorf("prod session sees entry %s of another profile", e.ID)
+		}
+		if own && (len(e.Params) != 1 || e.ParamsRedacted) {
+			t.Errorf("own entry params = %v, redacted %v", e.Params, e.ParamsRedacted)
+		}
+		if !own && (e.Params != nil || !e.ParamsRedacted) {
+			t.Errorf("sibling entry params = %v, redacted %v", e.Params, e.ParamsRedacted)
+		}
+	}
+
+	// An ad-hoc session only sees its own entries, whatever it filters on.
+	if entries := search(adhoc, ""); len(entries) != 1 || entries[0].ID != ids[adhoc] {
+		t.Errorf("ad-hoc session sees %+v", entries)
+	}
+	if entries := search(adhoc, "?profile=prod"); len(entries) != 0 {
+		t.Errorf("ad-hoc session sees %d prod entries", len(entries))
+	}
+	if entries := search(adhoc, "?session="+prodA.historyID); len(entries) != 0 {
+		t.Errorf("ad-hoc session sees %d entries of another session", len(entries))
+	}
+	if entries := search(prodB, "?session=current"); len(entries) != 1 || entries[0].ID != ids[prodB] {
+		t.Errorf("session=current = %+v", entries)
+	}
+}
+
+func TestHistoryEntryScope(t *testing.T) {
+	h, prodA, prodB, adhoc, ids := newHistoryFixture(t)
+
+	get := func(s *session, id string) (int, HistoryEntry) {
+		rec := historyRequest(t, h, h.HistoryEntry, http.MethodGet, "/history/"+id, id, s)
+		var e HistoryEntry
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, e
+	}
+
+	if code, e := get(prodA, ids[prodA]); code != http.StatusOK || len(e.Params) != 1 {
+		t.Errorf("own entry = %d %+v", code, e)
+	}
+	if code, e := get(prodA, ids[prodB]); code != http.StatusOK || e.Params != nil || !e.ParamsRedacted {
+		t.Errorf("sibling entry = %d %+v, want params redacted", code, e)
+	}
+	if code, _ := get(adhoc, ids[prodA]); code != http.StatusNotFound {
+		t.Errorf("other profile's entry = %d, want 404", code)
+	}
+	if code, _ := get(prodA, ids[adhoc]); code != http.StatusNotFound {
+		t.Errorf("ad-hoc session's entry = %d, want 404", code)
+	}
+}
+
+func TestRerunHistoryScope(t *testing.T) {
+	h, prodA, prodB, adhoc, ids := newHistoryFixture(t)
+
+	if rec := historyRequest(t, h, h.RerunHistory, http.MethodPost, "/history/x/rerun", ids[prodB], prodA); rec.Code != http.StatusForbidden {
+		t.Errorf("re-running a sibling's entry with params = %d, want 403", rec.Code)
+	}
+	if rec := historyRequest(t, h, h.RerunHistory, http.MethodPost, "/history/x/rerun", ids[prodA], adhoc); rec.Code != http.StatusNotFound {
+		t.Errorf("re-running another profile's entry = %d, want 404", rec.Code)
+	}
+}
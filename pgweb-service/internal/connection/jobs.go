@@ -0,0 +1,472 @@
+package connection
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pgweb-service/internal/util"
+
+	"github.com/lib/pq"
+)
+
+const (
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// queryJob is a statement running in the background, detached from the request that started
+// it. Its rows are kept in memory until the job expires.
+type queryJob struct {
+	ID        string
+	Query     string
+	StartedAt time.Time
+	cancel    context.CancelFunc
+
+	mu         sync.Mutex
+	status     string
+	finishedAt time.Time
+	columns    []util.Column
+	rows       [][]any
+	tag        string
+	affected   int64
+	truncated  bool
+	err        string
+	cancelled  bool
+}
+
+func (j *queryJob) setColumns(columns []util.Column) {
+	j.mu.Lock()
+	j.columns = columns
+	j.mu.Unlock()
+}
+
+func (j *queryJob) appendRow(row []any) {
+	j.mu.Lock()
+	j.rows = append(j.rows, row)
+	j.mu.Unlock()
+}
+
+func (j *queryJob) running() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status == jobRunning
+}
+
+func (j *queryJob) rowCount() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.rows)
+}
+
+// finish records the outcome of the job. A statement cancelled on the server (SQLSTATE 57014),
+// for instance through pg_cancel_backend, counts as cancelled unless the job ran out of time.
+func (j *queryJob) finish(res execResult, err error, timedOut bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.finishedAt = time.Now()
+	switch {
+	case err != nil && !timedOut && (j.cancelled || queryCanceled(err)):
+		j.status = jobCancelled
+		j.err = err.Error()
+	case err != nil:
+		j.status = jobFailed
+		j.err = err.Error()
+	default:
+		j.status = jobSucceeded
+		j.tag = res.Tag
+		j.affected = res.RowsAffected
+		j.truncated = res.Truncated
+	}
+}
+
+// queryCanceled reports whether err is Postgres' query_canceled error.
+func queryCanceled(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014"
+}
+
+// requestCancel stops a running job; it ends up cancelled rather than failed.
+func (j *queryJob) requestCancel() {
+	j.mu.Lock()
+	if j.status == jobRunning {
+		j.cancelled = true
+	}
+	j.mu.Unlock()
+	j.cancel()
+}
+
+// view describes the job, including up to limit of its rows starting at offset.
+func (j *queryJob) view(offset, limit int) map[string]any {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	end := time.Now()
+	if !j.finishedAt.IsZero() {
+		end = j.finishedAt
+	}
+	v := map[string]any{
+		"id":           j.ID,
+		"query":        j.Query,
+		"status":       j.status,
+		"started_at":   j.StartedAt,
+		"duration_ms":  end.Sub(j.StartedAt).Milliseconds(),
+		"rows_fetched": len(j.rows),
+	}
+	if !j.finishedAt.IsZero() {
+		v["finished_at"] = j.finishedAt
+	}
+	if j.err != "" {
+		v["error"] = j.err
+	}
+	if j.status != jobSucceeded || limit == 0 {
+		return v
+	}
+
+	v["command_tag"] = j.tag
+	v["rows_affected"] = j.affected
+	if j.columns == nil {
+		return v
+	}
+	start := min(offset, len(j.rows))
+	stop := min(start+limit, len(j.rows))
+	v["columns"] = j.columns
+	v["rows"] = j.rows[start:stop]
+	v["offset"] = start
+	v["has_more"] = stop < len(j.rows)
+	v["truncated"] = j.truncated
+	return v
+}
+
+// historyEntry describes the finished job for the query history.
+func (j *queryJob) historyEntry(params []any) HistoryEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return HistoryEntry{
+		Time:       j.StartedAt,
+		Query:      j.Query,
+		Params:     params,
+		Source:     "job",
+		DurationMS: j.finishedAt.Sub(j.StartedAt).Milliseconds(),
+		Rows:       historyRows(j.columns, len(j.rows), j.affected),
+		CommandTag: j.tag,
+		Truncated:  j.truncated,
+		Error:      j.err,
+	}
+}
+
+func (j *queryJob) expired(now time.Time, retention time.Duration) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status != jobRunning && now.Sub(j.finishedAt) >= retention
+}
+
+var (
+	errTooManyJobs        = errors.New("too many jobs")
+	errTooManyRunningJobs = errors.New("too many running jobs")
+)
+
+// queryJobs tracks a session's background query jobs.
+type queryJobs struct {
+	mu   sync.Mutex
+	byID map[string]*queryJob
+}
+
+func newQueryJobs() *queryJobs {
+	return &queryJobs{byID: make(map[string]*queryJob)}
+}
+
+// add records j unless the session already holds limit jobs, or runningLimit of them are
+// still running.
+func (qj *queryJobs) add(j *queryJob, limit, runningLimit int) error {
+	qj.mu.Lock()
+	defer qj.mu.Unlock()
+	if len(qj.byID) >= limit {
+		return errTooManyJobs
+	}
+	running := 0
+	for _, other := range qj.byID {
+		if other.running() {
+			running++
+		}
+	}
+	if running >= runningLimit {
+		return errTooManyRunningJobs
+	}
+	qj.byID[j.ID] = j
+	return nil
+}
+
+func (qj *queryJobs) get(id string) (*queryJob, bool) {
+	qj.mu.Lock()
+	defer qj.mu.Unlock()
+	j, ok := qj.byID[id]
+	return j, ok
+}
+
+func (qj *queryJobs) remove(id string) {
+	qj.mu.Lock()
+	delete(qj.byID, id)
+	qj.mu.Unlock()
+}
+
+func (qj *queryJobs) list() []*queryJob {
+	qj.mu.Lock()
+	defer qj.mu.Unlock()
+
+	list := make([]*queryJob, 0, len(qj.byID))
+	for _, j := range qj.byID {
+		list = append(list, j)
+	}
+	sort.Slice(list, func(i, k int) bool { return list[i].StartedAt.Before(list[k].StartedAt) })
+	return list
+}
+
+// retained reports whether any job is still running or holds a result that hasn't expired,
+// which keeps the session from being reaped.
+func (qj *queryJobs) retained(now time.Time, retention time.Duration) bool {
+	for _, j := range qj.list() {
+		if !j.expired(now, retention) {
+			return true
+		}
+	}
+	return false
+}
+
+// expire drops finished jobs older than retention.
+func (qj *queryJobs) expire(now time.Time, retention time.Duration) {
+	for _, j := range qj.list() {
+		if j.expired(now, retention) {
+			qj.remove(j.ID)
+		}
+	}
+}
+
+// cancelAll stops every running job, used when the session goes away.
+func (qj *queryJobs) cancelAll() {
+	for _, j := range qj.list() {
+		j.requestCancel()
+	}
+}
+
+// QueryJobs handles GET (list) and POST (start) on /query/jobs. A job takes the same query,
+// params and max_rows as /query, runs under its own deadline of up to PGWEB_JOB_TIMEOUT, and
+// its result stays available for PGWEB_JOB_RETENTION after it finishes.
+func (h *ConnectionHandler) QueryJobs(w http.ResponseWriter, req *http.Request) {
+	s, ok := h.ensureSession(w, req)
+	if !ok {
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		list := s.jobs.list()
+		items := make([]map[string]any, 0, len(list))
+		for _, j := range list {
+			items = append(items, j.view(0, 0))
+		}
+		util.WriteJSON(w, http.StatusOK, map[string]any{"jobs": items})
+	case http.MethodPost:
+		h.startQueryJob(w, req, s)
+	default:
+		http.Error(w, "This endpoint accepts only GET and POST calls", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *ConnectionHandler) startQueryJob(w http.ResponseWriter, req *http.Request, s *session) {
+	conn := s.connection
+
+	var payload struct {
+		Query     string    `json:"query"`
+		Params    []any     `json:"params"`
+		TimeoutMS IntValue  `json:"timeout_ms"`
+		MaxRows   IntValue  `json:"max_rows"`
+		Confirm   BoolValue `json:"confirm"`
+	}
+	dec := util.DecodeJsonBody(req)
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		http.Error(w, "Failed to decode request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(payload.Query) == "" {
+		http.Error(w, "query is required", http.StatusBadRequest)
+		return
+	}
+
+	args, err := bindParams(payload.Query, payload.Params)
+	if err != nil {
+		http.Error(w, "Invalid params: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if conn.ReadOnly {
+		if !allowReadOnly(w, payload.Query) {
+			return
+		}
+	}
+	if !confirmDestructive(w, bool(payload.Confirm), payload.Query) {
+		return
+	}
+
+	timeout := h.cfg.JobTimeout
+	switch ms := payload.TimeoutMS.Int(); {
+	case ms < 0:
+		http.Error(w, "Invalid timeout: timeout_ms must be >= 0", http.StatusBadRequest)
+		return
+	case ms > 0:
+		timeout = time.Duration(ms) * time.Millisecond
+		if timeout > h.cfg.JobTimeout {
+			http.Error(w, fmt.Sprintf("Invalid timeout: timeout of %s exceeds the job maximum of %s", timeout, h.cfg.JobTimeout), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if payload.MaxRows < 0 {
+		http.Error(w, "max_rows must be >= 0", http.StatusBadRequest)
+		return
+	}
+	maxRows := h.cfg.MaxJobRows
+	if n := payload.MaxRows.Int(); n > 0 && n < maxRows {
+		maxRows = n
+	}
+
+	id, err := randomID(8)
+	if err != nil {
+		http.Error(w, "Failed to create the job: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The job outlives the request, so its deadline hangs off the background context.
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	j := &queryJob{ID: id, Query: payload.Query, StartedAt: time.Now(), cancel: cancel, status: jobRunning}
+	s.jobs.expire(time.Now(), h.cfg.JobRetention)
+	runningLimit := h.runningJobLimit(s)
+	if err := s.jobs.add(j, h.cfg.MaxSessionJobs, runningLimit); err != nil {
+		cancel()
+		switch {
+		case errors.Is(err, errTooManyJobs):
+			http.Error(w, fmt.Sprintf("This session already holds %d jobs; wait for them to finish or DELETE finished ones", h.cfg.MaxSessionJobs), http.StatusTooManyRequests)
+		case runningLimit == 0:
+			http.Error(w, "This session's pool is too small to run jobs; reconnect with a larger pool.max_open_conns", http.StatusTooManyRequests)
+		default:
+			http.Error(w, fmt.Sprintf("This session already runs %d jobs; wait for one to finish", runningLimit), http.StatusTooManyRequests)
+		}
+		return
+	}
+
+	go func() {
+		defer cancel()
+		res, err := runQueryJob(ctx, s, j, args, timeout, maxRows)
+		j.finish(res, err, errors.Is(ctx.Err(), context.DeadlineExceeded))
+		h.recordHistory(s, j.historyEntry(payload.Params))
+	}()
+
+	util.WriteJSON(w, http.StatusAccepted, map[string]any{
+		"id":         j.ID,
+		"status":     jobRunning,
+		"timeout_ms": timeout.Milliseconds(),
+	})
+}
+
+// runningJobLimit is how many jobs s may run at once: PGWEB_MAX_RUNNING_JOBS, lowered to half
+// the session's pool when its connection asks for a smaller one.
+func (h *ConnectionHandler) runningJobLimit(s *session) int {
+	limit := h.cfg.MaxRunningJobs
+	if n := s.connection.Pool.MaxOpenConns.Int(); n > 0 && n/2 < limit {
+		limit = n / 2
+	}
+	return limit
+}
+
+func runQueryJob(ctx context.Context, s *session, j *queryJob, args []any, timeout time.Duration, maxRows int) (execResult, error) {
+	qc, release, err := acquireQueryConn(ctx, s.db, timeout)
+	if err != nil {
+		return execResult{}, fmt.Errorf("acquire a connection: %w", err)
+	}
+	defer release()
+
+	pid, err := backendPID(ctx, qc)
+	if err != nil {
+		return execResult{}, fmt.Errorf("identify the backend: %w", err)
+	}
+	_, unregister, err := s.running.register(pid, j.Query, j.requestCancel)
+	if err != nil {
+		return execResult{}, fmt.Errorf("register the query: %w", err)
+	}
+	defer unregister()
+
+	return execStatement(ctx, qc, j.Query, args, s.interruptBackend(pid), func(rows driver.Rows) error {
+		columns := util.DriverColumns(rows)
+		j.setColumns(columns)
+
+		values := make([]driver.Value, len(columns))
+		for {
+			if err := rows.Next(values); err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return err
+			}
+			if j.rowCount() == maxRows {
+				return errStopRows
+			}
+			j.appendRow(util.EncodeRow(columns, values))
+		}
+	})
+}
+
+// QueryJob handles GET (status and a page of results: ?offset=&limit=) and DELETE (cancel if
+// running, then forget) on /query/jobs/{id}.
+func (h *ConnectionHandler) QueryJob(w http.ResponseWriter, req *http.Request) {
+	s, ok := h.ensureSession(w, req)
+	if !ok {
+		return
+	}
+
+	id := req.PathValue("id")
+	j, found := s.jobs.get(id)
+	if !found {
+		http.Error(w, "Job "+id+" not found; it may have expired", http.StatusNotFound)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		offset, limit := 0, defaultTableDataLimit
+		query := req.URL.Query()
+		if v := query.Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			offset = n
+		}
+		if v := query.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > h.cfg.MaxResultRows {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", h.cfg.MaxResultRows), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		util.WriteJSON(w, http.StatusOK, j.view(offset, limit))
+	case http.MethodDelete:
+		j.requestCancel()
+		s.jobs.remove(id)
+		util.WriteJSON(w, http.StatusOK, map[string]any{"id": id, "deleted": true})
+	default:
+		http.Error(w, "This endpoint accepts only GET and DELETE calls", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,116 @@
+package connection
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func finishedJob(id string, finishedAt time.Time) *queryJob {
+	return &queryJob{ID: id, status: jobSucceeded, finishedAt: finishedAt, cancel: func() {}}
+}
+
+func TestQueryJobsRetained(t *testing.T) {
+	now := time.Now()
+	retention := time.Hour
+
+	qj := newQueryJobs()
+	if qj.retained(now, retention) {
+		t.Error("no jobs reported as retained")
+	}
+
+	qj.add(finishedJob("old", now.Add(-2*time.Hour)), 10, 10)
+	if qj.retained(now, retention) {
+		t.Error("a job past retention keeps the session alive")
+	}
+
+	// A finished result still within retention must outlive the session's idle timeout.
+	qj.add(finishedJob("recent", now.Add(-45*time.Minute)), 10, 10)
+	if !qj.retained(now, retention) {
+		t.Error("a job within retention doesn't keep the session alive")
+	}
+
+	qj.expire(now, retention)
+	if _, ok := qj.get("old"); ok {
+		t.Error("expire kept a job past retention")
+	}
+	if _, ok := qj.get("recent"); !ok {
+		t.Error("expire dropped a job within retention")
+	}
+
+	running := newQueryJobs()
+	running.add(&queryJob{ID: "r", status: jobRunning, cancel: func() {}}, 10, 10)
+	if !running.retained(now.Add(24*time.Hour), retention) {
+		t.Error("a running job doesn't keep the session alive")
+	}
+}
+
+func TestQueryJobsAddLimit(t *testing.T) {
+	qj := newQueryJobs()
+	for _, id := range []string{"a", "b"} {
+		if qj.add(finishedJob(id, time.Now()), 2, 2) != nil {
+			t.Fatalf("add(%s) refused below the limit", id)
+		}
+	}
+	if qj.add(finishedJob("c", time.Now()), 2, 2) == nil {
+		t.Error("add accepted a job over the limit")
+	}
+	qj.remove("a")
+	if qj.add(finishedJob("c", time.Now()), 2, 2) != nil {
+		t.Error("add refused after a job was removed")
+	}
+}
+
+func TestQueryJobsAddRunningLimit(t *testing.T) {
+	qj := newQueryJobs()
+	if err := qj.add(&queryJob{ID: "r", status: jobRunning, cancel: func() {}}, 10, 1); err != nil {
+		t.Fatalf("add refused the first running job: %v", err)
+	}
+	if err := qj.add(&queryJob{ID: "s", status: jobRunning, cancel: func() {}}, 10, 1); !errors.Is(err, errTooManyRunningJobs) {
+		t.Errorf("add over the running limit = %v, want errTooManyRunningJobs", err)
+	}
+
+	// Finished jobs don't count against the running limit.
+	r, _ := qj.get("r")
+	r.finish(execResult{}, nil, false)
+	if err := qj.add(&queryJob{ID: "s", status: jobRunning, cancel: func() {}}, 10, 1); err != nil {
+		t.Errorf("add refused after the running job finished: %v", err)
+	}
+}
+
+func TestRunningJobLimit(t *testing.T) {
+	h, s := newTestSession(t)
+	h.cfg.MaxRunningJobs = 5
+	if got := h.runningJobLimit(s); got != 5 {
+		t.Errorf("runningJobLimit with the default pool = %d, want 5", got)
+	}
+	s.connection.Pool.MaxOpenConns = 4
+	if got := h.runningJobLimit(s); got != 2 {
+		t.Errorf("runningJobLimit with a pool of 4 = %d, want 2", got)
+	}
+	s.connection.Pool.MaxOpenConns = 1
+	if got := h.runningJobLimit(s); got != 0 {
+		t.Errorf("runningJobLimit with a pool of 1 = %d, want 0", got)
+	}
+}
+
+func TestStartQueryJobOverLimit(t *testing.T) {
+	h, s := newTestSession(t)
+	h.cfg = Config{JobTimeout: time.Minute, JobRetention: time.Hour, MaxJobRows: 10, MaxSessionJobs: 1, MaxRunningJobs: 1}
+	s.jobs.add(finishedJob("kept", time.Now()), 1, 1)
+
+	req := httptest.NewRequest(http.MethodPost, "/query/jobs", strings.NewReader(`{"query": "SELECT 1"}`))
+	req.Header.Set(sessionHeaderName, s.id)
+	rec := httptest.NewRecorder()
+	h.QueryJobs(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("starting a job over the limit = %d %s, want 429", rec.Code, rec.Body)
+	}
+	if len(s.jobs.list()) != 1 {
+		t.Errorf("session holds %d jobs after a refused start", len(s.jobs.list()))
+	}
+}
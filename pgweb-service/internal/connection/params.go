@@ -0,0 +1,87 @@
+package connection
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"pgweb-service/internal/sqlparse"
+
+	"github.com/lib/pq"
+)
+
+// bindParams checks that query's $1..$n placeholders line up with params and converts the
+// decoded JSON values into driver arguments. The body must be decoded with UseNumber so
+// integers keep their precision.
+//
+//   - null, booleans and strings are passed through;
+//   - integers become int64, other numbers stay exact decimal strings;
+//   - arrays of scalars become Postgres arrays (for "= ANY($1)" and array columns);
+//   - objects and nested arrays are sent as JSON text (cast with $1::jsonb).
+func bindParams(query string, params []any) ([]any, error) {
+	used, err := sqlparse.Placeholders(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing query: %w", err)
+	}
+
+	for i, n := range used {
+		if n != i+1 {
+			return nil, fmt.Errorf("placeholder $%d is never used; placeholders must be numbered $1..$n without gaps", i+1)
+		}
+	}
+	if len(used) != len(params) {
+		return nil, fmt.Errorf("query uses %d placeholder(s) but %d param(s) were given", len(used), len(params))
+	}
+
+	args := make([]any, len(params))
+	for i, p := range params {
+		arg, err := convertParam(p, true)
+		if err != nil {
+			return nil, fmt.Errorf("param $%d: %w", i+1, err)
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
+
+func convertParam(p any, allowArray bool) (any, error) {
+	switch v := p.(type) {
+	case nil, bool, string:
+		return v, nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.String(), nil
+	case []any:
+		if allowArray && isScalarList(v) {
+			elems := make([]any, len(v))
+			for i, e := range v {
+				elems[i], _ = convertParam(e, false)
+			}
+			return pq.Array(elems), nil
+		}
+		return jsonText(v)
+	case map[string]any:
+		return jsonText(v)
+	default:
+		return nil, fmt.Errorf("unsupported value of type %T", p)
+	}
+}
+
+func isScalarList(values []any) bool {
+	for _, v := range values {
+		switch v.(type) {
+		case []any, map[string]any:
+			return false
+		}
+	}
+	return true
+}
+
+func jsonText(v any) (string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,106 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+// decodeParams decodes a JSON params list the way the query handlers do.
+func decodeParams(t *testing.T, raw string) []any {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.UseNumber()
+	var params []any
+	if err := dec.Decode(&params); err != nil {
+		t.Fatal(err)
+	}
+	return params
+}
+
+func TestBindParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		params string
+		want   []any
+	}{
+		{"no placeholders", "SELECT 1", `[]`, []any{}},
+		{
+			name:   "scalars",
+			query:  "SELECT $1, $2, $3, $4, $5, $6",
+			params: `[null, true, "x", 42, 9007199254740993, 1.50]`,
+			want:   []any{nil, true, "x", int64(42), int64(9007199254740993), "1.50"},
+		},
+		{
+			name:   "a placeholder used twice takes one param",
+			query:  "SELECT * FROM t WHERE a = $1 OR b = $1 OR c = $2",
+			params: `[1, 2]`,
+			want:   []any{int64(1), int64(2)},
+		},
+		{
+			name:   "placeholders out of order",
+			query:  "SELECT $2, $1",
+			params: `["a", "b"]`,
+			want:   []any{"a", "b"},
+		},
+		{
+			name:   "scalar list becomes an array",
+			query:  "SELECT * FROM t WHERE id = ANY($1)",
+			params: `[[1, 2, null]]`,
+			want:   []any{pq.Array([]any{int64(1), int64(2), nil})},
+		},
+		{
+			name:   "objects and nested arrays become JSON text",
+			query:  "SELECT $1::jsonb, $2::jsonb",
+			params: `[{"a": [1, 2]}, [[1], [2]]]`,
+			want:   []any{`{"a":[1,2]}`, `[[1],[2]]`},
+		},
+		{
+			name:   "placeholders in strings and comments don't count",
+			query:  "SELECT '$2', $1 -- $3",
+			params: `["x"]`,
+			want:   []any{"x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bindParams(tt.query, decodeParams(t, tt.params))
+			if err != nil {
+				t.Fatalf("bindParams: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bindParams = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindParamsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		params string
+		want   string
+	}{
+		{"too few params", "SELECT $1, $2", `[1]`, "uses 2 placeholder(s) but 1 param(s)"},
+		{"too many params", "SELECT $1", `[1, 2]`, "uses 1 placeholder(s) but 2 param(s)"},
+		{"params without placeholders", "SELECT 1", `[1]`, "uses 0 placeholder(s) but 1 param(s)"},
+		{"repeated placeholder counted once", "SELECT $1, $1", `[1, 1]`, "uses 1 placeholder(s) but 2 param(s)"},
+		{"gap in the numbering", "SELECT $1, $3", `[1, 2, 3]`, "placeholder $2 is never used"},
+		{"numbering not starting at 1", "SELECT $2", `[1, 2]`, "placeholder $1 is never used"},
+		{"unparsable query", "SELECT $1, 'oops", `[1]`, "failed parsing query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := bindParams(tt.query, decodeParams(t, tt.params))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("bindParams(%q, %s) error = %v, want %q", tt.query, tt.params, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package connection
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+
+	"pgweb-service/internal/secret"
+)
+
+var (
+	errProfileExists   = errors.New("profile already exists")
+	errProfileNotFound = errors.New("profile not found")
+
+	namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+)
+
+// Profile is a named, persisted set of connection parameters.
+type Profile struct {
+	Name       string     `json:"name"`
+	Connection Connection `json:"connection"`
+}
+
+// ProfileStore keeps connection profiles in a local JSON file with their secrets encrypted.
+type ProfileStore struct {
+	path     string
+	keyring  *secret.Keyring
+	mu       sync.Mutex
+	profiles map[string]Profile
+	// stale counts loaded entries that were plaintext or sealed with a non-primary key.
+	stale int
+}
+
+type profileFile struct {
+	Profiles []storedProfile `json:"profiles"`
+}
+
+// storedProfile is the on-disk form of a Profile; secret fields are blanked in Connection
+// and kept encrypted in Secrets, keyed by their JSON field name.
+type storedProfile struct {
+	Name       string            `json:"name"`
+	Connection Connection        `json:"connection"`
+	Secrets    map[string]string `json:"secrets,omitempty"`
+}
+
+// secretFields lists the Connection fields that must never be written in plaintext.
+// It copies c.SSH first so blanking a field never reaches a struct shared with the caller.
+func secretFields(c *Connection) map[string]*string {
+	fields := map[string]*string{
+		"password": &c.Password,
+		"ssl_key":  &c.SSLKey,
+	}
+	if c.SSH != nil {
+		tunnel := *c.SSH
+		c.SSH = &tunnel
+		fields["ssh_private_key"] = &tunnel.PrivateKey
+		fields["ssh_passphrase"] = &tunnel.Passphrase
+	}
+	return fields
+}
+
+// OpenProfileStore loads profiles from path, decrypting secrets with keyring; a missing file
+// is treated as an empty store. keyring may be nil as long as no stored profile carries secrets.
+func OpenProfileStore(path string, keyring *secret.Keyring) (*ProfileStore, error) {
+	s := &ProfileStore{
+		path:     path,
+		keyring:  keyring,
+		profiles: make(map[string]Profile),
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles file: %w", err)
+	}
+
+	var file profileFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles file %s: %w", path, err)
+	}
+	for _, stored := range file.Profiles {
+		p, stale, err := s.open(stored)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load profile %s: %w", stored.Name, err)
+		}
+		if stale {
+			s.stale++
+		}
+		s.profiles[p.Name] = p
+	}
+
+	return s, nil
+}
+
+// Reencrypt rewrites every profile under the keyring's primary key and reports how many
+// entries were previously plaintext or sealed with an older key.
+func (s *ProfileStore) Reencrypt() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stale := s.stale
+	if err := s.saveLocked(); err != nil {
+		return 0, err
+	}
+	return stale, nil
+}
+
+// seal converts a profile to its on-disk form, encrypting every non-empty secret field.
+func (s *ProfileStore) seal(p Profile) (storedProfile, error) {
+	stored := storedProfile{Name: p.Name, Connection: p.Connection}
+	for field, value := range secretFields(&stored.Connection) {
+		if *value == "" {
+			continue
+		}
+		sealed, err := s.keyring.Encrypt(*value)
+		if err != nil {
+			return storedProfile{}, fmt.Errorf("cannot store %s for profile %s: %w", field, p.Name, err)
+		}
+		if stored.Secrets == nil {
+			stored.Secrets = make(map[string]string)
+		}
+		stored.Secrets[field] = sealed
+		*value = ""
+	}
+	return stored, nil
+}
+
+// open decrypts an on-disk profile. Plaintext secrets left by older versions are accepted and
+// reported as stale so the next save (or Reencrypt) seals them.
+func (s *ProfileStore) open(stored storedProfile) (Profile, bool, error) {
+	p := Profile{Name: stored.Name, Connection: stored.Connection}
+	stale := false
+	for field, value := range secretFields(&p.Connection) {
+		if *value != "" {
+			stale = true
+		}
+		sealed, ok := stored.Secrets[field]
+		if !ok {
+			continue
+		}
+		plain, err := s.keyring.Decrypt(sealed)
+		if err != nil {
+			return Profile{}, false, fmt.Errorf("%s: %w", field, err)
+		}
+		if !s.keyring.IsCurrent(sealed) {
+			stale = true
+		}
+		*value = plain
+	}
+	return p, stale, nil
+}
+
+// List returns every profile ordered by name.
+func (s *ProfileStore) List() []Profile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sortedLocked()
+}
+
+// Get looks up a single profile by name.
+func (s *ProfileStore) Get(name string) (Profile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.profiles[name]
+	return p, ok
+}
+
+// Create adds a new profile and persists the store.
+func (s *ProfileStore) Create(p Profile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.profiles[p.Name]; ok {
+		return errProfileExists
+	}
+
+	s.profiles[p.Name] = p
+	if err := s.saveLocked(); err != nil {
+		delete(s.profiles, p.Name)
+		return err
+	}
+	return nil
+}
+
+// Update replaces an existing profile and persists the store.
+func (s *ProfileStore) Update(p Profile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.profiles[p.Name]
+	if !ok {
+		return errProfileNotFound
+	}
+
+	s.profiles[p.Name] = p
+	if err := s.saveLocked(); err != nil {
+		s.profiles[p.Name] = previous
+		return err
+	}
+	return nil
+}
+
+// Delete removes a profile and persists the store.
+func (s *ProfileStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.profiles[name]
+	if !ok {
+		return errProfileNotFound
+	}
+
+	delete(s.profiles, name)
+	if err := s.saveLocked(); err != nil {
+		s.profiles[name] = previous
+		return err
+	}
+	return nil
+}
+
+func (s *ProfileStore) sortedLocked() []Profile {
+	list := make([]Profile, 0, len(s.profiles))
+	for _, p := range s.profiles {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// saveLocked encrypts and writes the store atomically.
+func (s *ProfileStore) saveLocked() error {
+	file := profileFile{Profiles: make([]storedProfile, 0, len(s.profiles))}
+	for _, p := range s.sortedLocked() {
+		stored, err := s.seal(p)
+		if err != nil {
+			return err
+		}
+		file.Profiles = append(file.Profiles, stored)
+	}
+
+	raw, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.path, "profiles", raw); err != nil {
+		return err
+	}
+	s.stale = 0
+	return nil
+}
+
+func validateProfileName(name string) error {
+	if !namePattern.MatchString(name) {
+		return errors.New("profile name must start with a letter or digit and contain only letters, digits, '.', '_' or '-'")
+	}
+	return nil
+}
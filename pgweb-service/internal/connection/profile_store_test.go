@@ -0,0 +1,120 @@
+package connection
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pgweb-service/internal/secret"
+)
+
+func testKeyring(t *testing.T, keys ...byte) *secret.Keyring {
+	t.Helper()
+	raw := make([][]byte, len(keys))
+	for i, b := range keys {
+		raw[i] = bytes.Repeat([]byte{b}, 32)
+	}
+	k, err := secret.NewKeyring(raw...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestProfileStoreSealsSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	store, err := OpenProfileStore(path, testKeyring(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Profile{Name: "prod", Connection: Connection{
+		Host: "db", Port: 5432, Database: "app", Password: "hunter2",
+		SSH: &SSHTunnel{Host: "bastion", User: "ops", PrivateKey: "-----BEGIN KEY-----", Passphrase: "swordfish"},
+	}}
+	if err := store.Create(p); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plaintext := range []string{"hunter2", "BEGIN KEY", "swordfish"} {
+		if strings.Contains(string(raw), plaintext) {
+			t.Errorf("profiles file contains %q in plaintext", plaintext)
+		}
+	}
+	if got, _ := store.Get("prod"); got.Connection.SSH.Passphrase != "swordfish" {
+		t.Error("sealing modified the in-memory profile")
+	}
+
+	reopened, err := OpenProfileStore(path, testKeyring(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := reopened.Get("prod")
+	if !ok || got.Connection.Password != "hunter2" || got.Connection.SSH.PrivateKey != "-----BEGIN KEY-----" {
+		t.Errorf("reopened profile = %+v", got)
+	}
+
+	if _, err := OpenProfileStore(path, nil); err == nil {
+		t.Error("opening a store with sealed secrets without a keyring succeeded")
+	}
+}
+
+func TestProfileStoreReencrypt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	store, err := OpenProfileStore(path, testKeyring(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := store.Create(Profile{Name: name, Connection: Connection{Host: "db", Password: "pw-" + name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Rotate: key 2 becomes primary, key 1 stays readable until everything is re-sealed.
+	rotated, err := OpenProfileStore(path, testKeyring(t, 2, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := rotated.Reencrypt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("Reencrypt rotated %d profiles, want 2", n)
+	}
+
+	newOnly, err := OpenProfileStore(path, testKeyring(t, 2))
+	if err != nil {
+		t.Fatalf("opening with only the new key after Reencrypt: %v", err)
+	}
+	if got, _ := newOnly.Get("b"); got.Connection.Password != "pw-b" {
+		t.Errorf("password after rotation = %q", got.Connection.Password)
+	}
+	if n, _ := newOnly.Reencrypt(); n != 0 {
+		t.Errorf("second Reencrypt rotated %d profiles, want 0", n)
+	}
+}
+
+func TestProfileStoreWithoutKeyring(t *testing.T) {
+	store, err := OpenProfileStore(filepath.Join(t.TempDir(), "profiles.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(Profile{Name: "nopw", Connection: Connection{Host: "db"}}); err != nil {
+		t.Errorf("profile without secrets needs no keyring: %v", err)
+	}
+	err = store.Create(Profile{Name: "pw", Connection: Connection{Host: "db", Password: "x"}})
+	if !errors.Is(err, secret.ErrNoKey) {
+		t.Errorf("Create with a password and no keyring: %v, want ErrNoKey", err)
+	}
+	if _, ok := store.Get("pw"); ok {
+		t.Error("failed Create left the profile in the store")
+	}
+}
@@ -0,0 +1,177 @@
+package connection
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"pgweb-service/internal/secret"
+	"pgweb-service/internal/util"
+)
+
+// Profiles handles GET /profiles (list) and POST /profiles (create).
+func (h *ConnectionHandler) Profiles(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		profiles := h.profiles.List()
+		views := make([]map[string]any, 0, len(profiles))
+		for _, p := range profiles {
+			views = append(views, profileView(p))
+		}
+		util.WriteJSON(w, http.StatusOK, map[string]any{
+			"profiles": views,
+			"count":    len(views),
+		})
+	case http.MethodPost:
+		p, ok := decodeProfile(w, req, nil, h.cfg.CredentialsDir)
+		if !ok {
+			return
+		}
+		if err := h.profiles.Create(p); err != nil {
+			writeProfileError(w, p.Name, err)
+			return
+		}
+		util.WriteJSON(w, http.StatusCreated, profileView(p))
+	default:
+		http.Error(w, "This endpoint accepts only GET and POST calls", http.StatusMethodNotAllowed)
+	}
+}
+
+// Profile handles GET, PUT and DELETE on /profiles/{name}.
+func (h *ConnectionHandler) Profile(w http.ResponseWriter, req *http.Request) {
+	name := req.PathValue("name")
+
+	switch req.Method {
+	case http.MethodGet:
+		p, ok := h.profiles.Get(name)
+		if !ok {
+			writeProfileError(w, name, errProfileNotFound)
+			return
+		}
+		util.WriteJSON(w, http.StatusOK, profileView(p))
+	case http.MethodPut:
+		existing, found := h.profiles.Get(name)
+		if !found {
+			writeProfileError(w, name, errProfileNotFound)
+			return
+		}
+		p, ok := decodeProfile(w, req, &existing, h.cfg.CredentialsDir)
+		if !ok {
+			return
+		}
+		if p.Name != name {
+			http.Error(w, "profile name in body must match the URL", http.StatusBadRequest)
+			return
+		}
+		if err := h.profiles.Update(p); err != nil {
+			writeProfileError(w, name, err)
+			return
+		}
+		util.WriteJSON(w, http.StatusOK, profileView(p))
+	case http.MethodDelete:
+		if err := h.profiles.Delete(name); err != nil {
+			writeProfileError(w, name, err)
+			return
+		}
+		util.WriteJSON(w, http.StatusOK, map[string]any{
+			"message": "Profile " + name + " deleted",
+		})
+	default:
+		http.Error(w, "This endpoint accepts only GET, PUT and DELETE calls", http.StatusMethodNotAllowed)
+	}
+}
+
+// ConnectProfile handles POST /profiles/{name}/connect and opens a session from a stored profile.
+func (h *ConnectionHandler) ConnectProfile(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "This endpoint accepts only POST calls", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := req.PathValue("name")
+	p, ok := h.profiles.Get(name)
+	if !ok {
+		writeProfileError(w, name, errProfileNotFound)
+		return
+	}
+
+	db, res, err := openConnection(req.Context(), p.Connection, h.cfg.CredentialsDir, h.connectTimeout(p.Connection))
+	if err != nil {
+		log.Printf("Error connecting to profile %s: %v", name, err)
+		http.Error(w, "Failed to "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.startSession(w, req, p.Connection, p.Name, db, res)
+}
+
+// decodeProfile reads and validates a profile body. When updating, existing supplies the
+// stored secrets: GET never returns them, so an empty secret means "keep the stored one".
+// File paths must name files in the credentials directory.
+func decodeProfile(w http.ResponseWriter, req *http.Request, existing *Profile, credentialsDir string) (Profile, bool) {
+	var p Profile
+	dec := util.DecodeJsonBody(req)
+	if err := dec.Decode(&p); err != nil {
+		http.Error(w, "Failed to decode request body: "+err.Error(), http.StatusBadRequest)
+		return Profile{}, false
+	}
+
+	conn, err := expandURL(p.Connection)
+	if err != nil {
+		http.Error(w, "Invalid connection parameters: "+err.Error(), http.StatusBadRequest)
+		return Profile{}, false
+	}
+	p.Connection = conn
+
+	if existing != nil {
+		if p.Connection.Password == "" {
+			p.Connection.Password = existing.Connection.Password
+		}
+		if p.Connection.SSLKey == "" && p.Connection.SSLCert != "" {
+			p.Connection.SSLKey = existing.Connection.SSLKey
+		}
+		if tunnel, old := p.Connection.SSH, existing.Connection.SSH; tunnel != nil && old != nil && tunnel.PrivateKey == "" && !tunnel.UseAgent {
+			tunnel.PrivateKey = old.PrivateKey
+			tunnel.Passphrase = old.Passphrase
+		}
+	}
+
+	if err := validateProfileName(p.Name); err != nil {
+		http.Error(w, "Invalid profile: "+err.Error(), http.StatusBadRequest)
+		return Profile{}, false
+	}
+	if err := validateConnection(p.Connection, credentialsDir); err != nil {
+		http.Error(w, "Invalid connection parameters: "+err.Error(), http.StatusBadRequest)
+		return Profile{}, false
+	}
+
+	return p, true
+}
+
+// profileView renders a profile for API responses without its secrets.
+func profileView(p Profile) map[string]any {
+	view := map[string]any{
+		"name":         p.Name,
+		"has_password": p.Connection.Password != "",
+		"has_ssl_key":  p.Connection.SSLKey != "",
+	}
+	for _, value := range secretFields(&p.Connection) {
+		*value = ""
+	}
+	view["connection"] = p.Connection
+	return view
+}
+
+func writeProfileError(w http.ResponseWriter, name string, err error) {
+	switch {
+	case errors.Is(err, errProfileNotFound):
+		http.Error(w, "Profile "+name+" not found", http.StatusNotFound)
+	case errors.Is(err, errProfileExists):
+		http.Error(w, "Profile "+name+" already exists", http.StatusConflict)
+	case errors.Is(err, secret.ErrNoKey):
+		http.Error(w, "Cannot store profile secrets: "+err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("Error persisting profile %s: %v", name, err)
+		http.Error(w, "Failed to save profiles: "+err.Error(), http.StatusInternalServerError)
+	}
+}
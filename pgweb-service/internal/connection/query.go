@@ -2,10 +2,14 @@ package connection
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
 	"net/http"
 	"strings"
 	"time"
 
+	"pgweb-service/internal/sqlparse"
 	"pgweb-service/internal/util"
 )
 
@@ -16,52 +20,445 @@ func (h *ConnectionHandler) ExecuteQuery(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	db, _, ok := h.ensureDB(w)
+	s, ok := h.ensureSession(w, req)
 	if !ok {
 		return
 	}
+	conn := s.connection
 
 	var payload struct {
-		Query string `json:"query"`
+		Query     string    `json:"query"`
+		Params    []any     `json:"params"`
+		TimeoutMS IntValue  `json:"timeout_ms"`
+		Mode      string    `json:"mode"`
+		OnError   string    `json:"on_error"`
+		Stream    BoolValue `json:"stream"`
+		MaxRows   IntValue  `json:"max_rows"`
+
+		// Confirm allows destructive statements, see confirmDestructive.
+		Confirm BoolValue `json:"confirm"`
+
+		TransactionID string `json:"transaction_id"`
+
+		// Snippet runs a saved snippet instead of query, with Variables bound to its
+		// {{variable}} placeholders.
+		Snippet   string         `json:"snippet"`
+		Variables map[string]any `json:"variables"`
 	}
 	dec := util.DecodeJsonBody(req)
+	dec.UseNumber()
 	if err := dec.Decode(&payload); err != nil {
 		http.Error(w, "Failed to decode request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	if payload.Snippet != "" {
+		if payload.Query != "" || len(payload.Params) > 0 {
+			http.Error(w, "query and params can't be combined with snippet; use variables", http.StatusBadRequest)
+			return
+		}
+		sn, found := h.snippets.Get(payload.Snippet)
+		if !found {
+			writeSnippetError(w, payload.Snippet, errSnippetNotFound)
+			return
+		}
+		query, params, err := bindVariables(sn.Query, payload.Variables)
+		if err != nil {
+			http.Error(w, "Invalid variables: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		payload.Query, payload.Params = query, params
+	} else if len(payload.Variables) > 0 {
+		http.Error(w, "variables are only used with snippet", http.StatusBadRequest)
+		return
+	}
+
 	if strings.TrimSpace(payload.Query) == "" {
 		http.Error(w, "query is required", http.StatusBadRequest)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(req.Context(), 15*time.Second)
+	var (
+		args       []any
+		statements []sqlparse.Statement
+		err        error
+	)
+	switch payload.Mode {
+	case "", "single":
+		args, err = bindParams(payload.Query, payload.Params)
+		if err != nil {
+			http.Error(w, "Invalid params: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "script":
+		if len(payload.Params) > 0 {
+			http.Error(w, "params are not supported in script mode", http.StatusBadRequest)
+			return
+		}
+		if payload.Stream {
+			http.Error(w, "stream is not supported in script mode", http.StatusBadRequest)
+			return
+		}
+		statements, err = sqlparse.Split(payload.Query)
+		if err != nil {
+			http.Error(w, "Failed parsing query: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(statements) == 0 {
+			http.Error(w, "query contains no statements", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "mode must be single or script", http.StatusBadRequest)
+		return
+	}
+
+	if payload.MaxRows < 0 {
+		http.Error(w, "max_rows must be >= 0", http.StatusBadRequest)
+		return
+	}
+	maxRows := h.cfg.MaxResultRows
+	if payload.Stream {
+		maxRows = h.cfg.MaxStreamRows
+	}
+	if n := payload.MaxRows.Int(); n > 0 && n < maxRows {
+		maxRows = n
+	}
+
+	continueOnError := false
+	switch payload.OnError {
+	case "", "stop":
+	case "continue":
+		continueOnError = true
+	default:
+		http.Error(w, "on_error must be stop or continue", http.StatusBadRequest)
+		return
+	}
+
+	if conn.ReadOnly {
+		texts := []string{payload.Query}
+		if statements != nil {
+			texts = texts[:0]
+			for _, st := range statements {
+				texts = append(texts, st.Text)
+			}
+		}
+		if !allowReadOnly(w, texts...) {
+			return
+		}
+	}
+	if !confirmDestructive(w, bool(payload.Confirm), payload.Query) {
+		return
+	}
+
+	timeout, err := h.resolveTimeout(payload.TimeoutMS.Int(), conn, h.cfg.QueryTimeout)
+	if err != nil {
+		http.Error(w, "Invalid timeout: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
 	defer cancel()
 
-	rows, err := db.QueryContext(ctx, payload.Query)
+	var (
+		qc        *sql.Conn
+		pid       int
+		interrupt func() error
+	)
+	if payload.TransactionID != "" {
+		control, err := isTransactionControl(payload.Query)
+		if err != nil {
+			http.Error(w, "Failed parsing query: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if control {
+			http.Error(w, "Use the /transactions endpoints to commit or roll back an interactive transaction", http.StatusBadRequest)
+			return
+		}
+
+		t, release, err := s.transactions.acquire(payload.TransactionID)
+		if err != nil {
+			writeTransactionError(w, err)
+			return
+		}
+		defer release()
+		qc, pid = t.conn, t.PID
+		setTransactionTimeout(ctx, qc, timeout)
+	} else {
+		pinned, release, err := acquireQueryConn(ctx, s.db, timeout)
+		if err != nil {
+			http.Error(w, "Failed to acquire a connection: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer release()
+		qc = pinned
+
+		if pid, err = backendPID(ctx, qc); err != nil {
+			http.Error(w, "Failed to identify the backend: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Truncated reads are cancelled unless a script opens a transaction of its own.
+		if control, err := isTransactionControl(payload.Query); err == nil && !control {
+			interrupt = s.interruptBackend(pid)
+		}
+	}
+	running, unregister, err := s.running.register(pid, payload.Query, cancel)
 	if err != nil {
-		// fall back to Exec for statements that don't return rows
-		if execRes, execErr := db.ExecContext(ctx, payload.Query); execErr == nil {
-			rowsAffected, _ := execRes.RowsAffected()
-			util.WriteJSON(w, http.StatusOK, map[string]any{
-				"rows_affected": rowsAffected,
-				"result":        "statement executed",
+		http.Error(w, "Failed to register the query: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer unregister()
+	w.Header().Set("X-Pgweb-Query-Id", running.ID)
+
+	start := time.Now()
+	if statements != nil {
+		results, stopped := runScript(ctx, qc, statements, continueOnError, maxRows, interrupt)
+		for _, res := range results {
+			h.recordHistory(s, HistoryEntry{
+				Time:          start,
+				Query:         res.Statement,
+				Snippet:       payload.Snippet,
+				Source:        "script",
+				TransactionID: payload.TransactionID,
+				DurationMS:    res.DurationMS,
+				Rows:          historyRows(res.Columns, len(res.Rows), res.RowsAffected),
+				CommandTag:    res.CommandTag,
+				Truncated:     res.Truncated,
+				Error:         res.Error,
 			})
-			return
 		}
-		http.Error(w, "Failed executing query: "+err.Error(), http.StatusBadRequest)
+		util.WriteJSON(w, http.StatusOK, map[string]any{
+			"results": results,
+			"stopped": stopped,
+		})
 		return
 	}
-	defer rows.Close()
 
-	cols, data, err := util.RowsToMaps(rows)
+	entry := HistoryEntry{
+		Time:          start,
+		Query:         payload.Query,
+		Params:        payload.Params,
+		Snippet:       payload.Snippet,
+		Source:        "query",
+		TransactionID: payload.TransactionID,
+	}
+
+	if payload.Stream {
+		out := util.NewNDJSONWriter(w, streamFlushRows)
+		res, sent, err := streamStatement(ctx, qc, payload.Query, args, maxRows, interrupt, out)
+		entry.Source = "stream"
+		entry.DurationMS = res.DurationMS
+		entry.Rows = historyRows(res.Columns, sent, res.RowsAffected)
+		entry.CommandTag = res.CommandTag
+		entry.Truncated = res.Truncated
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		h.recordHistory(s, entry)
+		if err != nil {
+			if !out.Started() {
+				http.Error(w, "Failed executing query: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			_ = out.Write(map[string]any{"type": "error", "error": err.Error()})
+		}
+		_ = out.Flush()
+		return
+	}
+
+	res, err := runStatement(ctx, qc, payload.Query, args, maxRows, interrupt)
+	entry.DurationMS = res.DurationMS
+	entry.Rows = historyRows(res.Columns, len(res.Rows), res.RowsAffected)
+	entry.CommandTag = res.CommandTag
+	entry.Truncated = res.Truncated
 	if err != nil {
-		http.Error(w, "Failed reading row data: "+err.Error(), http.StatusInternalServerError)
+		entry.Error = err.Error()
+	}
+	h.recordHistory(s, entry)
+	if err != nil {
+		http.Error(w, "Failed executing query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if res.Columns == nil {
+		util.WriteJSON(w, http.StatusOK, map[string]any{
+			"rows_affected": res.RowsAffected,
+			"command_tag":   res.CommandTag,
+			"result":        "statement executed",
+		})
 		return
 	}
 
 	util.WriteJSON(w, http.StatusOK, map[string]any{
-		"columns": cols,
-		"rows":    data,
+		"columns":     res.Columns,
+		"rows":        res.Rows,
+		"command_tag": res.CommandTag,
+		"truncated":   res.Truncated,
+	})
+}
+
+// allowReadOnly checks statements bound for a read-only connection, writing the error
+// response and returning false if any of them may write.
+func allowReadOnly(w http.ResponseWriter, texts ...string) bool {
+	for _, text := range texts {
+		readOnly, err := sqlparse.IsReadOnly(text)
+		if err != nil {
+			http.Error(w, "Failed parsing query: "+err.Error(), http.StatusBadRequest)
+			return false
+		}
+		if !readOnly {
+			writeReadOnlyError(w)
+			return false
+		}
+	}
+	return true
+}
+
+// confirmDestructive checks for statements that drop, truncate or alter objects, or update or
+// delete without a WHERE clause. Unless the caller confirmed them, it writes a 409 listing
+// their classification, so the UI can ask before resending with "confirm": true, and returns
+// false. Read-only connections reject such statements before this check, confirmed or not.
+func confirmDestructive(w http.ResponseWriter, confirmed bool, texts ...string) bool {
+	if confirmed {
+		return true
+	}
+	destructive := make([]sqlparse.Classification, 0)
+	for _, text := range texts {
+		list, err := sqlparse.Classify(text)
+		if err != nil {
+			http.Error(w, "Failed parsing query: "+err.Error(), http.StatusBadRequest)
+			return false
+		}
+		for _, c := range list {
+			if c.Destructive {
+				destructive = append(destructive, c)
+			}
+		}
+	}
+	if len(destructive) == 0 {
+		return true
+	}
+	util.WriteJSON(w, http.StatusConflict, map[string]any{
+		"error":            "The query contains destructive statements; resend it with \"confirm\": true to run it",
+		"confirm_required": true,
+		"statements":       destructive,
+	})
+	return false
+}
+
+// statementResult is the outcome of one statement. Columns and Rows are null for statements
+// that don't return rows.
+type statementResult struct {
+	Statement    string        `json:"statement"`
+	Columns      []util.Column `json:"columns"`
+	Rows         [][]any       `json:"rows"`
+	RowsAffected int64         `json:"rows_affected"`
+	CommandTag   string        `json:"command_tag,omitempty"`
+	Truncated    bool          `json:"truncated,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	DurationMS   int64         `json:"duration_ms"`
+}
+
+// runScript executes statements one by one on qc. Unless continueOnError is set it stops at
+// the first failing statement; stopped reports whether statements were left unexecuted.
+// interrupt is passed on to execStatement.
+func runScript(ctx context.Context, qc *sql.Conn, statements []sqlparse.Statement, continueOnError bool, maxRows int, interrupt func() error) ([]statementResult, bool) {
+	results := make([]statementResult, 0, len(statements))
+	for i, st := range statements {
+		res, err := runStatement(ctx, qc, st.Text, nil, maxRows, interrupt)
+		if err != nil {
+			res.Error = err.Error()
+		}
+		results = append(results, res)
+
+		if err != nil && (!continueOnError || ctx.Err() != nil) {
+			return results, i < len(statements)-1
+		}
+	}
+	return results, false
+}
+
+// runStatement executes a single statement and collects its rows (at most maxRows of them)
+// or affected row count. interrupt is passed on to execStatement.
+func runStatement(ctx context.Context, qc *sql.Conn, query string, args []any, maxRows int, interrupt func() error) (statementResult, error) {
+	res := statementResult{Statement: query}
+	start := time.Now()
+
+	exec, err := execStatement(ctx, qc, query, args, interrupt, func(rows driver.Rows) error {
+		var (
+			truncated bool
+			err       error
+		)
+		res.Columns = util.DriverColumns(rows)
+		res.Rows, truncated, err = util.ReadDriverRows(rows, res.Columns, maxRows)
+		if err == nil && truncated {
+			return errStopRows
+		}
+		return err
+	})
+	res.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		res.Columns, res.Rows = nil, nil
+		return res, err
+	}
+	res.CommandTag = exec.Tag
+	res.RowsAffected = exec.RowsAffected
+	res.Truncated = exec.Truncated
+	return res, nil
+}
+
+// streamFlushRows is how many NDJSON lines are buffered before flushing to the client.
+const streamFlushRows = 100
+
+// streamStatement executes a single statement and writes its result as NDJSON while the rows
+// are scanned: a {"type":"columns"} line, one {"type":"row"} line per row (at most maxRows),
+// then a {"type":"complete"} line with the command tag and truncation flag. Nothing is
+// written if the statement fails before returning a row description. The returned result
+// carries no rows; sent is how many were written. interrupt is passed on to execStatement.
+func streamStatement(ctx context.Context, qc *sql.Conn, query string, args []any, maxRows int, interrupt func() error, out *util.NDJSONWriter) (res statementResult, sent int, err error) {
+	res.Statement = query
+	start := time.Now()
+	defer func() { res.DurationMS = time.Since(start).Milliseconds() }()
+
+	exec, err := execStatement(ctx, qc, query, args, interrupt, func(rows driver.Rows) error {
+		columns := util.DriverColumns(rows)
+		res.Columns = columns
+		if err := out.Write(map[string]any{"type": "columns", "columns": columns}); err != nil {
+			return err
+		}
+		if err := out.Flush(); err != nil {
+			return err
+		}
+
+		values := make([]driver.Value, len(columns))
+		for {
+			if err := rows.Next(values); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+			if sent == maxRows {
+				return errStopRows
+			}
+			if err := out.Write(map[string]any{"type": "row", "row": util.EncodeRow(columns, values)}); err != nil {
+				return err
+			}
+			sent++
+		}
+	})
+	if err != nil {
+		return res, sent, err
+	}
+	res.CommandTag = exec.Tag
+	res.RowsAffected = exec.RowsAffected
+	res.Truncated = exec.Truncated
+
+	return res, sent, out.Write(map[string]any{
+		"type":          "complete",
+		"rows":          sent,
+		"rows_affected": exec.RowsAffected,
+		"command_tag":   exec.Tag,
+		"truncated":     exec.Truncated,
+		"duration_ms":   time.Since(start).Milliseconds(),
 	})
 }
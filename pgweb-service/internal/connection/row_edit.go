@@ -0,0 +1,219 @@
+package connection
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pgweb-service/internal/util"
+
+	"github.com/lib/pq"
+)
+
+// rowChange is one insert, update or delete against a table. Key identifies the row by the
+// table's primary (or unique) key; Values holds the columns to write.
+type rowChange struct {
+	Key    map[string]any `json:"key"`
+	Values map[string]any `json:"values"`
+}
+
+// buildRowStatement turns change into a parameterized INSERT, UPDATE or DELETE ... RETURNING *
+// for schema.table. Column names are checked against columns, and update/delete must name
+// every key column and nothing else in Key.
+func buildRowStatement(op, schemaName, tableName string, change rowChange, columns []tableColumn, key tableKey) (string, []any, error) {
+	target := pq.QuoteIdentifier(schemaName) + "." + pq.QuoteIdentifier(tableName)
+	args := make([]any, 0)
+	bind := func(column string, v any) (string, error) {
+		arg, err := convertParam(v, true)
+		if err != nil {
+			return "", fmt.Errorf("column %q: %w", column, err)
+		}
+		args = append(args, arg)
+		return "$" + strconv.Itoa(len(args)), nil
+	}
+
+	// Walk columns in table order so the generated SQL is deterministic.
+	known := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		known[c.Name] = true
+	}
+	for name := range change.Values {
+		if !known[name] {
+			return "", nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+
+	var names, placeholders []string
+	for _, c := range columns {
+		v, ok := change.Values[c.Name]
+		if !ok {
+			continue
+		}
+		p, err := bind(c.Name, v)
+		if err != nil {
+			return "", nil, err
+		}
+		names = append(names, pq.QuoteIdentifier(c.Name))
+		placeholders = append(placeholders, p)
+	}
+
+	if op == "insert" {
+		if len(change.Key) > 0 {
+			return "", nil, errors.New("key is not used for inserts; put every column in values")
+		}
+		if len(names) == 0 {
+			return "INSERT INTO " + target + " DEFAULT VALUES RETURNING *", args, nil
+		}
+		return "INSERT INTO " + target + " (" + strings.Join(names, ", ") + ") VALUES (" +
+			strings.Join(placeholders, ", ") + ") RETURNING *", args, nil
+	}
+
+	if len(key.Columns) == 0 {
+		return "", nil, errors.New("table has no primary key or unique key over NOT NULL columns; rows can't be addressed safely")
+	}
+	if len(change.Key) != len(key.Columns) {
+		return "", nil, fmt.Errorf("key must contain exactly the key columns %s", strings.Join(key.Columns, ", "))
+	}
+	var where []string
+	for _, name := range key.Columns {
+		v, ok := change.Key[name]
+		if !ok {
+			return "", nil, fmt.Errorf("key must contain exactly the key columns %s", strings.Join(key.Columns, ", "))
+		}
+		if v == nil {
+			return "", nil, fmt.Errorf("key column %q cannot be null", name)
+		}
+		p, err := bind(name, v)
+		if err != nil {
+			return "", nil, err
+		}
+		where = append(where, pq.QuoteIdentifier(name)+" = "+p)
+	}
+
+	switch op {
+	case "update":
+		if len(names) == 0 {
+			return "", nil, errors.New("values must set at least one column")
+		}
+		// The SET placeholders were bound first, so they line up with names.
+		set := make([]string, len(names))
+		for i := range names {
+			set[i] = names[i] + " = " + placeholders[i]
+		}
+		return "UPDATE " + target + " SET " + strings.Join(set, ", ") +
+			" WHERE " + strings.Join(where, " AND ") + " RETURNING *", args, nil
+	case "delete":
+		if len(change.Values) > 0 {
+			return "", nil, errors.New("values are not used for deletes")
+		}
+		return "DELETE FROM " + target + " WHERE " + strings.Join(where, " AND ") + " RETURNING *", args, nil
+	default:
+		return "", nil, fmt.Errorf("unknown operation %q", op)
+	}
+}
+
+// TableRows handles POST (insert), PATCH (update) and DELETE on
+// /schemas/{schema}/tables/{table}/rows. Updates and deletes address exactly one row by key
+// and the affected row is returned as written by the server.
+func (h *ConnectionHandler) TableRows(w http.ResponseWriter, req *http.Request) {
+	var op string
+	switch req.Method {
+	case http.MethodPost:
+		op = "insert"
+	case http.MethodPatch:
+		op = "update"
+	case http.MethodDelete:
+		op = "delete"
+	default:
+		http.Error(w, "This endpoint accepts only POST, PATCH and DELETE calls", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, conn, ok := h.ensureDB(w, req)
+	if !ok {
+		return
+	}
+	if conn.ReadOnly {
+		writeReadOnlyError(w)
+		return
+	}
+
+	schemaName := req.PathValue("schema")
+	tableName := req.PathValue("table")
+	if schemaName == "" || tableName == "" {
+		http.Error(w, "schema and table parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	var change rowChange
+	dec := util.DecodeJsonBody(req)
+	dec.UseNumber()
+	if err := dec.Decode(&change); err != nil {
+		http.Error(w, "Failed to decode request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, ok := h.requestContext(w, req, conn, h.cfg.QueryTimeout)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	columns, err := tableColumns(ctx, db, schemaName, tableName)
+	if errors.Is(err, errTableNotFound) {
+		http.Error(w, "Table not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed fetching column metadata: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key, err := lookupTableKey(ctx, db, schemaName, tableName)
+	if err != nil {
+		http.Error(w, "Failed fetching table key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	query, args, err := buildRowStatement(op, schemaName, tableName, change, columns, key)
+	if err != nil {
+		http.Error(w, "Invalid row change: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		http.Error(w, "Failed to "+op+" row: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer rows.Close()
+
+	resultColumns, err := util.SQLColumns(rows)
+	if err != nil {
+		http.Error(w, "Failed reading row columns: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	markNullable(resultColumns, columns)
+	result, err := util.ReadSQLRows(rows, resultColumns)
+	if err != nil {
+		http.Error(w, "Failed to "+op+" row: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(result) == 0 {
+		http.Error(w, "No row matches the given key", http.StatusNotFound)
+		return
+	}
+
+	status := http.StatusOK
+	if op == "insert" {
+		status = http.StatusCreated
+	}
+	util.WriteJSON(w, status, map[string]any{
+		"schema":  schemaName,
+		"table":   tableName,
+		"key":     key.Columns,
+		"columns": resultColumns,
+		"row":     result[0],
+	})
+}
@@ -0,0 +1,101 @@
+package connection
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildRowStatement(t *testing.T) {
+	columns := []tableColumn{
+		{Name: "tenant", Type: "integer"},
+		{Name: "id", Type: "integer"},
+		{Name: "Display Name", Type: "text", Nullable: true},
+		{Name: `quo"te`, Type: "text", Nullable: true},
+	}
+	key := tableKey{Columns: []string{"tenant", "id"}, Primary: true}
+	tests := []struct {
+		name   string
+		op     string
+		change rowChange
+		sql    string
+		args   []any
+	}{
+		{
+			name:   "insert in table order",
+			op:     "insert",
+			change: rowChange{Values: map[string]any{`quo"te`: "x", "id": json.Number("2"), "tenant": json.Number("1")}},
+			sql:    `INSERT INTO "my schema"."T" ("tenant", "id", "quo""te") VALUES ($1, $2, $3) RETURNING *`,
+			args:   []any{int64(1), int64(2), "x"},
+		},
+		{
+			name: "insert defaults",
+			op:   "insert",
+			sql:  `INSERT INTO "my schema"."T" DEFAULT VALUES RETURNING *`,
+			args: []any{},
+		},
+		{
+			name: "update numbers SET before WHERE",
+			op:   "update",
+			change: rowChange{
+				Key:    map[string]any{"id": json.Number("2"), "tenant": json.Number("1")},
+				Values: map[string]any{"Display Name": "Ann", `quo"te`: nil},
+			},
+			sql:  `UPDATE "my schema"."T" SET "Display Name" = $1, "quo""te" = $2 WHERE "tenant" = $3 AND "id" = $4 RETURNING *`,
+			args: []any{"Ann", nil, int64(1), int64(2)},
+		},
+		{
+			name:   "delete",
+			op:     "delete",
+			change: rowChange{Key: map[string]any{"tenant": json.Number("1"), "id": "2"}},
+			sql:    `DELETE FROM "my schema"."T" WHERE "tenant" = $1 AND "id" = $2 RETURNING *`,
+			args:   []any{int64(1), "2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := buildRowStatement(tt.op, "my schema", "T", tt.change, columns, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != tt.sql || !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("buildRowStatement =\n%s %#v\nwant\n%s %#v", sql, args, tt.sql, tt.args)
+			}
+		})
+	}
+}
+
+func TestBuildRowStatementErrors(t *testing.T) {
+	columns := []tableColumn{{Name: "tenant"}, {Name: "id"}, {Name: "name"}}
+	key := tableKey{Columns: []string{"tenant", "id"}, Primary: true}
+	fullKey := map[string]any{"tenant": json.Number("1"), "id": json.Number("2")}
+	tests := []struct {
+		name   string
+		op     string
+		change rowChange
+		key    tableKey
+		want   string
+	}{
+		{"unknown value column", "update", rowChange{Key: fullKey, Values: map[string]any{"nope": 1}}, key, `unknown column "nope"`},
+		{"unknown column on insert", "insert", rowChange{Values: map[string]any{"nope": "x"}}, key, `unknown column "nope"`},
+		{"key on insert", "insert", rowChange{Key: fullKey}, key, "not used for inserts"},
+		{"incomplete key", "update", rowChange{Key: map[string]any{"id": json.Number("2")}, Values: map[string]any{"name": "x"}}, key, "exactly the key columns tenant, id"},
+		{"extra key column", "delete", rowChange{Key: map[string]any{"tenant": json.Number("1"), "id": json.Number("2"), "name": "x"}}, key, "exactly the key columns"},
+		{"non-key column in key", "delete", rowChange{Key: map[string]any{"tenant": json.Number("1"), "name": "x"}}, key, "exactly the key columns"},
+		{"null key value", "delete", rowChange{Key: map[string]any{"tenant": json.Number("1"), "id": nil}}, key, `key column "id" cannot be null`},
+		{"no key on the table", "delete", rowChange{Key: fullKey}, tableKey{}, "no primary key"},
+		{"update without values", "update", rowChange{Key: fullKey}, key, "at least one column"},
+		{"delete with values", "delete", rowChange{Key: fullKey, Values: map[string]any{"name": "x"}}, key, "not used for deletes"},
+		{"unsupported value", "update", rowChange{Key: fullKey, Values: map[string]any{"name": 1.5}}, key, `column "name": unsupported value`},
+		{"unknown operation", "upsert", rowChange{Key: fullKey}, key, `unknown operation "upsert"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := buildRowStatement(tt.op, "public", "t", tt.change, columns, tt.key)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("buildRowStatement error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"pgweb-service/internal/util"
+)
+
+// cancelGracePeriod is how long CancelQuery waits for the driver's cancel request to stop a
+// statement before falling back to pg_cancel_backend.
+const cancelGracePeriod = 2 * time.Second
+
+// cancelBackendTimeout bounds connecting for and running pg_cancel_backend.
+const cancelBackendTimeout = 5 * time.Second
+
+// runningQuery is a statement currently executing on one of a session's backends.
+type runningQuery struct {
+	ID        string
+	PID       int
+	Query     string
+	StartedAt time.Time
+	cancel    context.CancelFunc
+	// done is closed once the statement is unregistered.
+	done chan struct{}
+	// pin is write-locked by unregister, before the statement's connection can go back to
+	// the pool, so read-locking it keeps PID naming this statement's backend.
+	pin sync.RWMutex
+}
+
+// runningQueries tracks a session's in-flight statements so they can be listed and cancelled.
+type runningQueries struct {
+	mu      sync.Mutex
+	queries map[string]*runningQuery
+}
+
+func newRunningQueries() *runningQueries {
+	return &runningQueries{queries: make(map[string]*runningQuery)}
+}
+
+// register records a running statement and returns a func that removes it again.
+func (r *runningQueries) register(pid int, query string, cancel context.CancelFunc) (*runningQuery, func(), error) {
+	id, err := randomID(8)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q := &runningQuery{ID: id, PID: pid, Query: query, StartedAt: time.Now(), cancel: cancel, done: make(chan struct{})}
+	r.mu.Lock()
+	r.queries[id] = q
+	r.mu.Unlock()
+
+	return q, func() {
+		r.mu.Lock()
+		delete(r.queries, id)
+		r.mu.Unlock()
+
+		q.pin.Lock()
+		close(q.done)
+		q.pin.Unlock()
+	}, nil
+}
+
+func (r *runningQueries) get(id string) (*runningQuery, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	q, ok := r.queries[id]
+	return q, ok
+}
+
+// whileRunning calls fn with the query if id is still registered. The statement can't
+// finish, and its pinned backend go back to the pool, while fn runs; other queries are
+// registered, listed and unregistered as usual.
+func (r *runningQueries) whileRunning(id string, fn func(*runningQuery)) bool {
+	r.mu.Lock()
+	q, ok := r.queries[id]
+	if ok {
+		// unregister only write-locks pin after removing q, so this can't block.
+		q.pin.RLock()
+	}
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	defer q.pin.RUnlock()
+	fn(q)
+	return true
+}
+
+func (r *runningQueries) list() []*runningQuery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]*runningQuery, 0, len(r.queries))
+	for _, q := range r.queries {
+		list = append(list, q)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.Before(list[j].StartedAt) })
+	return list
+}
+
+// backendPID returns the Postgres backend PID serving a pinned connection.
+func backendPID(ctx context.Context, conn *sql.Conn) (int, error) {
+	var pid int
+	err := conn.QueryRowContext(ctx, `SELECT pg_backend_pid()`).Scan(&pid)
+	return pid, err
+}
+
+// cancelBackend runs pg_cancel_backend(pid) over a connection of its own rather than one
+// from the session's pool, which may be exhausted by the very statements being cancelled.
+func (s *session) cancelBackend(ctx context.Context, pid int) (bool, error) {
+	if s.resources == nil || s.resources.connector == nil {
+		return false, errors.New("session has no connector")
+	}
+	db := sql.OpenDB(s.resources.connector)
+	defer db.Close()
+
+	var cancelled bool
+	err := db.QueryRowContext(ctx, `SELECT pg_cancel_backend($1)`, pid).Scan(&cancelled)
+	return cancelled, err
+}
+
+// interruptBackend returns an interrupt func for execStatement that cancels the statement
+// backend pid is running.
+func (s *session) interruptBackend(pid int) func() error {
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), cancelBackendTimeout)
+		defer cancel()
+		cancelled, err := s.cancelBackend(ctx, pid)
+		if err == nil && !cancelled {
+			err = fmt.Errorf("backend %d not found", pid)
+		}
+		return err
+	}
+}
+
+// ListRunningQueries handles GET /queries/running for the caller's session.
+func (h *ConnectionHandler) ListRunningQueries(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "This endpoint accepts only GET calls", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, ok := h.ensureSession(w, req)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	queries := make([]map[string]any, 0)
+	for _, q := range s.running.list() {
+		queries = append(queries, map[string]any{
+			"id":          q.ID,
+			"pid":         q.PID,
+			"query":       q.Query,
+			"started_at":  q.StartedAt,
+			"duration_ms": now.Sub(q.StartedAt).Milliseconds(),
+		})
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{
+		"queries": queries,
+		"count":   len(queries),
+	})
+}
+
+// CancelQuery handles POST /queries/{id}/cancel. Cancelling the statement's context makes
+// lib/pq send a cancel request for exactly the connection running it; pg_cancel_backend is only
+// tried if the statement is still registered after cancelGracePeriod, over a connection of its
+// own and within cancelBackendTimeout.
+func (h *ConnectionHandler) CancelQuery(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "This endpoint accepts only POST calls", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, ok := h.ensureSession(w, req)
+	if !ok {
+		return
+	}
+
+	id := req.PathValue("id")
+	q, found := s.running.get(id)
+	if !found {
+		http.Error(w, "Query "+id+" is not running in this session", http.StatusNotFound)
+		return
+	}
+
+	q.cancel()
+	cancelled := true
+	select {
+	case <-q.done:
+	case <-time.After(cancelGracePeriod):
+		ctx, cancel := context.WithTimeout(req.Context(), cancelBackendTimeout)
+		defer cancel()
+
+		s.running.whileRunning(id, func(q *runningQuery) {
+			// The backend is still pinned to this statement, so its PID can't name another one.
+			var err error
+			cancelled, err = s.cancelBackend(ctx, q.PID)
+			if err != nil {
+				log.Printf("pg_cancel_backend(%d) failed: %v", q.PID, err)
+				cancelled = false
+			}
+		})
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{
+		"id":        q.ID,
+		"pid":       q.PID,
+		"cancelled": cancelled,
+	})
+}
@@ -0,0 +1,151 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// newTestSession registers a session without a database behind it.
+func newTestSession(t *testing.T) (*ConnectionHandler, *session) {
+	t.Helper()
+	s, err := newSession(Connection{Host: "db", Database: "app"}, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ConnectionHandler{sessions: map[string]*session{s.id: s}}, s
+}
+
+func TestCancelQueryCancelsThroughTheDriver(t *testing.T) {
+	h, s := newTestSession(t)
+
+	// The statement stops as soon as its context is cancelled, like lib/pq does once its
+	// cancel request lands, so pg_cancel_backend is never needed.
+	var unregister func()
+	cancelled := make(chan struct{})
+	q, unregister, err := s.running.register(4242, "SELECT pg_sleep(60)", func() {
+		close(cancelled)
+		unregister()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/queries/"+q.ID+"/cancel", nil)
+	req.SetPathValue("id", q.ID)
+	req.Header.Set(sessionHeaderName, s.id)
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	h.CancelQuery(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cancel = %d %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		PID       int  `json:"pid"`
+		Cancelled bool `json:"cancelled"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if !body.Cancelled || body.PID != 4242 {
+		t.Errorf("cancel response = %s", rec.Body)
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Error("the statement's context was not cancelled")
+	}
+	if time.Since(start) >= cancelGracePeriod {
+		t.Error("CancelQuery waited out the grace period for a statement that had stopped")
+	}
+
+	rec = httptest.NewRecorder()
+	h.CancelQuery(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("cancelling a finished query = %d, want 404", rec.Code)
+	}
+}
+
+func TestWhileRunning(t *testing.T) {
+	r := newRunningQueries()
+	q, unregister, err := r.register(1, "SELECT 1", func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	called := false
+	if !r.whileRunning(q.ID, func(*runningQuery) { called = true }) || !called {
+		t.Error("whileRunning skipped a registered query")
+	}
+
+	// fn doesn't block the registry, but the query can't finish before fn returns.
+	unregistered := make(chan struct{})
+	r.whileRunning(q.ID, func(*runningQuery) {
+		_, other, err := r.register(2, "SELECT 2", func() {})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.list()) != 2 {
+			t.Errorf("list inside whileRunning = %d queries, want 2", len(r.list()))
+		}
+		other()
+
+		go func() {
+			unregister()
+			close(unregistered)
+		}()
+		select {
+		case <-unregistered:
+			t.Error("the query was unregistered while whileRunning's fn ran")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+	<-unregistered
+	select {
+	case <-q.done:
+	default:
+		t.Error("done not closed on unregister")
+	}
+	if r.whileRunning(q.ID, func(*runningQuery) { t.Error("fn called for an unregistered query") }) {
+		t.Error("whileRunning reported an unregistered query as running")
+	}
+}
+
+func TestJobFinishStatus(t *testing.T) {
+	canceled := &pq.Error{Code: "57014", Message: "canceling statement due to user request"}
+	tests := []struct {
+		name      string
+		err       error
+		requested bool
+		timedOut  bool
+		want      string
+	}{
+		{"success", nil, false, false, jobSucceeded},
+		{"error", errors.New("relation does not exist"), false, false, jobFailed},
+		{"cancelled through the API", context.Canceled, true, false, jobCancelled},
+		{"cancelled on the server", canceled, false, false, jobCancelled},
+		{"wrapped query_canceled", fmt.Errorf("run: %w", canceled), false, false, jobCancelled},
+		{"timed out", canceled, false, true, jobFailed},
+		{"other SQLSTATE", &pq.Error{Code: "42P01"}, false, false, jobFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &queryJob{status: jobRunning, cancel: func() {}}
+			if tt.requested {
+				j.requestCancel()
+			}
+			j.finish(execResult{}, tt.err, tt.timedOut)
+			if j.status != tt.want {
+				t.Errorf("status = %s, want %s", j.status, tt.want)
+			}
+		})
+	}
+}
@@ -2,10 +2,13 @@ package connection
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
-	"time"
 
 	"pgweb-service/internal/util"
 
@@ -19,12 +22,15 @@ func (h *ConnectionHandler) ListSchemas(w http.ResponseWriter, req *http.Request
 		return
 	}
 
-	db, _, ok := h.ensureDB(w)
+	db, conn, ok := h.ensureDB(w, req)
 	if !ok {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(req.Context(), 2*time.Second)
+	ctx, cancel, ok := h.requestContext(w, req, conn, h.cfg.CatalogTimeout)
+	if !ok {
+		return
+	}
 	defer cancel()
 
 	// fetch the schemas from the db
@@ -68,12 +74,15 @@ func (h *ConnectionHandler) ListTablesForSchema(w http.ResponseWriter, req *http
 		return
 	}
 
-	db, _, ok := h.ensureDB(w)
+	db, conn, ok := h.ensureDB(w, req)
 	if !ok {
 		log.Default().Println("Aborting execution due to unconfigured conifguration")
 		return
 	}
-	ctx, cancel := context.WithTimeout(req.Context(), 2*time.Second)
+	ctx, cancel, ok := h.requestContext(w, req, conn, h.cfg.CatalogTimeout)
+	if !ok {
+		return
+	}
 	defer cancel()
 
 	// query the database for actual tables from the requested schema
@@ -121,7 +130,7 @@ func (h *ConnectionHandler) ListTableColumns(w http.ResponseWriter, req *http.Re
 		return
 	}
 
-	db, _, ok := h.ensureDB(w)
+	db, conn, ok := h.ensureDB(w, req)
 	if !ok {
 		return
 	}
@@ -133,7 +142,10 @@ func (h *ConnectionHandler) ListTableColumns(w http.ResponseWriter, req *http.Re
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(req.Context(), 2*time.Second)
+	ctx, cancel, ok := h.requestContext(w, req, conn, h.cfg.CatalogTimeout)
+	if !ok {
+		return
+	}
 	defer cancel()
 
 	rows, err := db.QueryContext(ctx, `
@@ -192,14 +204,15 @@ func (h *ConnectionHandler) ListTableColumns(w http.ResponseWriter, req *http.Re
 	})
 }
 
-// ListTableData returns every row from schema.table, projecting arbitrary columns into JSON.
+// ListTableData returns a page of rows from schema.table, filtered, ordered and projected as
+// requested (see parseTableDataQuery), plus a row count.
 func (h *ConnectionHandler) ListTableData(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
 		http.Error(w, "This call only supports GET methods", http.StatusMethodNotAllowed)
 		return
 	}
 
-	db, _, ok := h.ensureDB(w)
+	db, conn, ok := h.ensureDB(w, req)
 	if !ok {
 		return
 	}
@@ -211,29 +224,139 @@ func (h *ConnectionHandler) ListTableData(w http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
+	ctx, cancel, ok := h.requestContext(w, req, conn, h.cfg.TableDataTimeout)
+	if !ok {
+		return
+	}
 	defer cancel()
 
+	columns, err := tableColumns(ctx, db, schemaName, tableName)
+	if errors.Is(err, errTableNotFound) {
+		http.Error(w, "Table not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed fetching column metadata: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key, err := lookupTableKey(ctx, db, schemaName, tableName)
+	if err != nil {
+		http.Error(w, "Failed fetching table key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	q, err := parseTableDataQuery(req.URL.Query(), columns, key, h.cfg.MaxResultRows)
+	if err != nil {
+		http.Error(w, "Invalid table data request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Quote the identifiers to avoid SQL injection via path parameters.
-	query := `SELECT * FROM ` + pq.QuoteIdentifier(schemaName) + `.` + pq.QuoteIdentifier(tableName)
-	rows, err := db.QueryContext(ctx, query)
+	from := pq.QuoteIdentifier(schemaName) + `.` + pq.QuoteIdentifier(tableName)
+	query, args, err := q.selectSQL(from)
+	if err != nil {
+		http.Error(w, "Invalid table data request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		http.Error(w, "Failed fetching table data: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
 
-	_, result, err := util.RowsToMaps(rows)
+	resultColumns, err := util.SQLColumns(rows)
+	if err != nil {
+		http.Error(w, "Failed reading table columns: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result, err := util.ReadSQLRows(rows, resultColumns)
 	if err != nil {
 		http.Error(w, "Failed reading table rows: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	util.WriteJSON(w, http.StatusOK, map[string]any{
-		"schema": schemaName,
-		"table":  tableName,
-		"rows":   result,
-	})
+	// The order columns' text forms trail the projection; they only feed next_cursor.
+	projected := len(q.columns)
+	resultColumns = resultColumns[:projected]
+	markNullable(resultColumns, columns)
+
+	hasMore := len(result) > q.limit
+	if hasMore {
+		result = result[:q.limit]
+	}
+	var nextCursor string
+	if hasMore && len(key.Columns) > 0 {
+		last := result[len(result)-1][projected:]
+		values := make([]*string, len(last))
+		for i, v := range last {
+			if s, ok := v.(string); ok {
+				values[i] = &s
+			}
+		}
+		nextCursor = encodeTableCursor(q.orderSpec(), values)
+	}
+	for i := range result {
+		result[i] = result[i][:projected]
+	}
+
+	response := map[string]any{
+		"schema":   schemaName,
+		"table":    tableName,
+		"columns":  resultColumns,
+		"rows":     result,
+		"limit":    q.limit,
+		"offset":   q.offset,
+		"order_by": q.orderSpec(),
+		"has_more": hasMore,
+	}
+	if nextCursor != "" {
+		response["next_cursor"] = nextCursor
+	}
+
+	if q.count != "none" {
+		countQuery, countArgs, err := q.countSQL(from)
+		if err != nil {
+			http.Error(w, "Invalid table data request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		count, err := countRows(ctx, db, countQuery, countArgs, q.count == "exact")
+		if err != nil {
+			http.Error(w, "Failed counting table rows: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if q.count == "exact" {
+			response["total_count"] = count
+		} else {
+			response["estimated_count"] = count
+		}
+	}
+
+	util.WriteJSON(w, http.StatusOK, response)
+}
+
+// countRows runs a count query built by countSQL: either an exact count(*) or an EXPLAIN whose
+// top plan node carries the planner's row estimate.
+func countRows(ctx context.Context, db *sql.DB, query string, args []any, exact bool) (int64, error) {
+	if exact {
+		var n int64
+		err := db.QueryRowContext(ctx, query, args...).Scan(&n)
+		return n, err
+	}
+
+	var raw []byte
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&raw); err != nil {
+		return 0, err
+	}
+	var plan []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(raw, &plan); err != nil || len(plan) == 0 {
+		return 0, fmt.Errorf("unexpected EXPLAIN output: %s", raw)
+	}
+	return int64(plan[0].Plan.Rows), nil
 }
 
 // ListViewsForSchema enumerates views in a schema.
@@ -243,12 +366,15 @@ func (h *ConnectionHandler) ListViewsForSchema(w http.ResponseWriter, req *http.
 		return
 	}
 
-	db, _, ok := h.ensureDB(w)
+	db, conn, ok := h.ensureDB(w, req)
 	if !ok {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(req.Context(), 2*time.Second)
+	ctx, cancel, ok := h.requestContext(w, req, conn, h.cfg.CatalogTimeout)
+	if !ok {
+		return
+	}
 	defer cancel()
 
 	schemaName := req.PathValue("schema")
@@ -293,44 +419,32 @@ func (h *ConnectionHandler) ListIndexesForSchema(w http.ResponseWriter, req *htt
 		return
 	}
 
-	db, _, ok := h.ensureDB(w)
+	db, conn, ok := h.ensureDB(w, req)
 	if !ok {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(req.Context(), 2*time.Second)
+	ctx, cancel, ok := h.requestContext(w, req, conn, h.cfg.CatalogTimeout)
+	if !ok {
+		return
+	}
 	defer cancel()
 
 	schemaName := req.PathValue("schema")
-	rows, err := db.QueryContext(ctx, `
-		select indexname, tablename
-		from pg_catalog.pg_indexes
-		where schemaname = $1
-		order by indexname
-	`, schemaName,
-	)
+	list, err := schemaIndexes(ctx, db, schemaName)
 	if err != nil {
-		http.Error(w, "Failed fetching the index names", http.StatusInternalServerError)
+		http.Error(w, "Failed fetching the index names: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	indexes := make([]map[string]string, 0)
-	for rows.Next() {
-		var name, table string
-		if err := rows.Scan(&name, &table); err != nil {
-			http.Error(w, "Failed to scan index row: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		indexes = append(indexes, map[string]string{
-			"index": name,
-			"table": table,
+	indexes := make([]map[string]any, 0, len(list))
+	for _, idx := range list {
+		indexes = append(indexes, map[string]any{
+			"index":   idx.Name,
+			"table":   idx.Table,
+			"columns": idx.Columns,
 		})
 	}
-	if err := rows.Err(); err != nil {
-		http.Error(w, "Failed to iterate indexes: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
 
 	util.WriteJSON(w, http.StatusOK, map[string]any{
 		"schema":  schemaName,
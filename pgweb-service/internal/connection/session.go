@@ -0,0 +1,146 @@
+package connection
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	sessionCookieName = "pgweb_session"
+	sessionHeaderName = "X-Pgweb-Session"
+)
+
+// session is a single client's connection pool plus the bookkeeping needed to reap it.
+type session struct {
+	id           string
+	historyID    string // identifies the session in query history without revealing its token
+	connection   Connection
+	profile      string // name of the profile used to connect, if any
+	db           *sql.DB
+	resources    *poolResources
+	running      *runningQueries
+	transactions *transactions
+	jobs         *queryJobs
+	lastUsed     atomic.Int64 // unix nanoseconds
+}
+
+func newSession(conn Connection, profile string, db *sql.DB, res *poolResources) (*session, error) {
+	id, err := randomID(32)
+	if err != nil {
+		return nil, err
+	}
+	historyID, err := randomID(8)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &session{
+		id:         id,
+		historyID:  historyID,
+		connection: conn,
+		profile:    profile,
+		db:         db,
+		resources:  res,
+		running:    newRunningQueries(),
+
+		transactions: newTransactions(),
+		jobs:         newQueryJobs(),
+	}
+	s.touch()
+	return s, nil
+}
+
+func (s *session) touch() {
+	s.lastUsed.Store(time.Now().UnixNano())
+}
+
+func (s *session) idleSince(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, s.lastUsed.Load()))
+}
+
+// close cancels the session's running jobs, rolls back its open transactions and releases its
+// pool and the resources that lived alongside it.
+func (s *session) close() error {
+	s.jobs.cancelAll()
+	s.transactions.rollbackIdle(time.Now(), 0)
+	err := s.db.Close()
+	if resErr := s.resources.close(); err == nil {
+		err = resErr
+	}
+	return err
+}
+
+// sessionID extracts the session token from the request header or cookie.
+func sessionID(req *http.Request) string {
+	if id := req.Header.Get(sessionHeaderName); id != "" {
+		return id
+	}
+	if cookie, err := req.Cookie(sessionCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// writeSessionToken hands the token back to the client as both a cookie and a header.
+func writeSessionToken(w http.ResponseWriter, s *session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    s.id,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set(sessionHeaderName, s.id)
+}
+
+// clearSessionToken expires the session cookie after the session is closed.
+func clearSessionToken(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// reapIdleSessions periodically closes sessions that exceeded the idle timeout, unless they
+// still have jobs running or job results within retention, and rolls back idle transactions
+// and drops expired job results in the remaining ones.
+func (h *ConnectionHandler) reapIdleSessions() {
+	interval := min(h.cfg.SessionIdleTimeout/2, h.cfg.TransactionIdleTimeout/2, h.cfg.JobRetention/2, time.Minute)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		h.mu.Lock()
+		expired := make([]*session, 0)
+		active := make([]*session, 0, len(h.sessions))
+		for id, s := range h.sessions {
+			if s.idleSince(now) >= h.cfg.SessionIdleTimeout && !s.jobs.retained(now, h.cfg.JobRetention) {
+				expired = append(expired, s)
+				delete(h.sessions, id)
+			} else {
+				active = append(active, s)
+			}
+		}
+		h.mu.Unlock()
+
+		for _, s := range active {
+			s.transactions.rollbackIdle(now, h.cfg.TransactionIdleTimeout)
+			s.jobs.expire(now, h.cfg.JobRetention)
+		}
+
+		for _, s := range expired {
+			if err := s.close(); err != nil {
+				log.Printf("Error closing idle session for database %s: %v", s.connection.Database, err)
+			}
+			log.Printf("Closed idle session for database %s", s.connection.Database)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package connection
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pgweb-service/internal/sqlparse"
+)
+
+var (
+	errSnippetExists   = errors.New("snippet already exists")
+	errSnippetNotFound = errors.New("snippet not found")
+)
+
+// Snippet is a named, shared SQL template. Its {{variable}} placeholders are bound as query
+// parameters when it is executed.
+type Snippet struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Query       string    `json:"query"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// variables lists the snippet's distinct variable names in order of first use.
+func (sn Snippet) variables() []string {
+	vars, _ := sqlparse.Variables(sn.Query)
+	names := make([]string, 0, len(vars))
+	seen := make(map[string]bool, len(vars))
+	for _, v := range vars {
+		if !seen[v.Name] {
+			seen[v.Name] = true
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
+
+// hasTag reports whether the snippet carries tag, ignoring case.
+func (sn Snippet) hasTag(tag string) bool {
+	for _, t := range sn.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// SnippetStore keeps snippets in a local JSON file.
+type SnippetStore struct {
+	path     string
+	mu       sync.Mutex
+	snippets map[string]Snippet
+}
+
+type snippetFile struct {
+	Snippets []Snippet `json:"snippets"`
+}
+
+// OpenSnippetStore loads snippets from path; a missing file is treated as an empty store.
+func OpenSnippetStore(path string) (*SnippetStore, error) {
+	s := &SnippetStore{
+		path:     path,
+		snippets: make(map[string]Snippet),
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snippets file: %w", err)
+	}
+
+	var file snippetFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse snippets file %s: %w", path, err)
+	}
+	for _, sn := range file.Snippets {
+		s.snippets[sn.Name] = sn
+	}
+
+	return s, nil
+}
+
+// List returns every snippet ordered by name.
+func (s *SnippetStore) List() []Snippet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sortedLocked()
+}
+
+// Get looks up a single snippet by name.
+func (s *SnippetStore) Get(name string) (Snippet, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sn, ok := s.snippets[name]
+	return sn, ok
+}
+
+// Create adds a new snippet and persists the store.
+func (s *SnippetStore) Create(sn Snippet) (Snippet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.snippets[sn.Name]; ok {
+		return Snippet{}, errSnippetExists
+	}
+
+	sn.CreatedAt = time.Now().UTC()
+	sn.UpdatedAt = sn.CreatedAt
+	s.snippets[sn.Name] = sn
+	if err := s.saveLocked(); err != nil {
+		delete(s.snippets, sn.Name)
+		return Snippet{}, err
+	}
+	return sn, nil
+}
+
+// Update replaces an existing snippet, keeping its creation time, and persists the store.
+func (s *SnippetStore) Update(sn Snippet) (Snippet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.snippets[sn.Name]
+	if !ok {
+		return Snippet{}, errSnippetNotFound
+	}
+
+	sn.CreatedAt = previous.CreatedAt
+	sn.UpdatedAt = time.Now().UTC()
+	s.snippets[sn.Name] = sn
+	if err := s.saveLocked(); err != nil {
+		s.snippets[sn.Name] = previous
+		return Snippet{}, err
+	}
+	return sn, nil
+}
+
+// Delete removes a snippet and persists the store.
+func (s *SnippetStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.snippets[name]
+	if !ok {
+		return errSnippetNotFound
+	}
+
+	delete(s.snippets, name)
+	if err := s.saveLocked(); err != nil {
+		s.snippets[name] = previous
+		return err
+	}
+	return nil
+}
+
+func (s *SnippetStore) sortedLocked() []Snippet {
+	list := make([]Snippet, 0, len(s.snippets))
+	for _, sn := range s.snippets {
+		list = append(list, sn)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// saveLocked writes the store atomically.
+func (s *SnippetStore) saveLocked() error {
+	raw, err := json.MarshalIndent(snippetFile{Snippets: s.sortedLocked()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, "snippets", raw)
+}
@@ -0,0 +1,216 @@
+package connection
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"pgweb-service/internal/sqlparse"
+	"pgweb-service/internal/util"
+)
+
+// Snippets handles GET /snippets (list, optionally narrowed by ?tag= and a case-insensitive
+// ?q= over name, description and query) and POST /snippets (create).
+func (h *ConnectionHandler) Snippets(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		tag := req.URL.Query().Get("tag")
+		text := strings.ToLower(req.URL.Query().Get("q"))
+
+		views := make([]map[string]any, 0)
+		for _, sn := range h.snippets.List() {
+			if tag != "" && !sn.hasTag(tag) {
+				continue
+			}
+			if text != "" && !strings.Contains(strings.ToLower(sn.Name+"\n"+sn.Description+"\n"+sn.Query), text) {
+				continue
+			}
+			views = append(views, snippetView(sn))
+		}
+		util.WriteJSON(w, http.StatusOK, map[string]any{
+			"snippets": views,
+			"count":    len(views),
+		})
+	case http.MethodPost:
+		sn, ok := decodeSnippet(w, req)
+		if !ok {
+			return
+		}
+		created, err := h.snippets.Create(sn)
+		if err != nil {
+			writeSnippetError(w, sn.Name, err)
+			return
+		}
+		util.WriteJSON(w, http.StatusCreated, snippetView(created))
+	default:
+		http.Error(w, "This endpoint accepts only GET and POST calls", http.StatusMethodNotAllowed)
+	}
+}
+
+// Snippet handles GET, PUT and DELETE on /snippets/{name}.
+func (h *ConnectionHandler) Snippet(w http.ResponseWriter, req *http.Request) {
+	name := req.PathValue("name")
+
+	switch req.Method {
+	case http.MethodGet:
+		sn, ok := h.snippets.Get(name)
+		if !ok {
+			writeSnippetError(w, name, errSnippetNotFound)
+			return
+		}
+		util.WriteJSON(w, http.StatusOK, snippetView(sn))
+	case http.MethodPut:
+		sn, ok := decodeSnippet(w, req)
+		if !ok {
+			return
+		}
+		if sn.Name != name {
+			http.Error(w, "snippet name in body must match the URL", http.StatusBadRequest)
+			return
+		}
+		sn, err := h.snippets.Update(sn)
+		if err != nil {
+			writeSnippetError(w, name, err)
+			return
+		}
+		util.WriteJSON(w, http.StatusOK, snippetView(sn))
+	case http.MethodDelete:
+		if err := h.snippets.Delete(name); err != nil {
+			writeSnippetError(w, name, err)
+			return
+		}
+		util.WriteJSON(w, http.StatusOK, map[string]any{
+			"message": "Snippet " + name + " deleted",
+		})
+	default:
+		http.Error(w, "This endpoint accepts only GET, PUT and DELETE calls", http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeSnippet reads and validates a snippet body.
+func decodeSnippet(w http.ResponseWriter, req *http.Request) (Snippet, bool) {
+	var payload struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Tags        []string `json:"tags"`
+		Query       string   `json:"query"`
+	}
+	if err := util.DecodeJsonBody(req).Decode(&payload); err != nil {
+		http.Error(w, "Failed to decode request body: "+err.Error(), http.StatusBadRequest)
+		return Snippet{}, false
+	}
+
+	sn := Snippet{
+		Name:        payload.Name,
+		Description: payload.Description,
+		Tags:        payload.Tags,
+		Query:       payload.Query,
+	}
+	if err := validateSnippet(&sn); err != nil {
+		http.Error(w, "Invalid snippet: "+err.Error(), http.StatusBadRequest)
+		return Snippet{}, false
+	}
+	return sn, true
+}
+
+// snippetView renders a snippet for API responses, listing the variables it takes.
+func snippetView(sn Snippet) map[string]any {
+	tags := sn.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return map[string]any{
+		"name":        sn.Name,
+		"description": sn.Description,
+		"tags":        tags,
+		"query":       sn.Query,
+		"variables":   sn.variables(),
+		"created_at":  sn.CreatedAt,
+		"updated_at":  sn.UpdatedAt,
+	}
+}
+
+func writeSnippetError(w http.ResponseWriter, name string, err error) {
+	switch {
+	case errors.Is(err, errSnippetNotFound):
+		http.Error(w, "Snippet "+name+" not found", http.StatusNotFound)
+	case errors.Is(err, errSnippetExists):
+		http.Error(w, "Snippet "+name+" already exists", http.StatusConflict)
+	default:
+		log.Printf("Error persisting snippet %s: %v", name, err)
+		http.Error(w, "Failed to save snippets: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// validateSnippet checks a snippet before it is stored and normalises its tags.
+func validateSnippet(sn *Snippet) error {
+	if !namePattern.MatchString(sn.Name) {
+		return errors.New("snippet name must start with a letter or digit and contain only letters, digits, '.', '_' or '-'")
+	}
+	if strings.TrimSpace(sn.Query) == "" {
+		return errors.New("query is required")
+	}
+	if _, err := sqlparse.Variables(sn.Query); err != nil {
+		return fmt.Errorf("failed parsing query: %w", err)
+	}
+	numbers, err := sqlparse.Placeholders(sn.Query)
+	if err != nil {
+		return fmt.Errorf("failed parsing query: %w", err)
+	}
+	if len(numbers) > 0 {
+		return errors.New("snippets use {{variable}} placeholders instead of $n")
+	}
+
+	tags := make([]string, 0, len(sn.Tags))
+	seen := make(map[string]bool, len(sn.Tags))
+	for _, t := range sn.Tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[strings.ToLower(t)] {
+			continue
+		}
+		seen[strings.ToLower(t)] = true
+		tags = append(tags, t)
+	}
+	sn.Tags = tags
+	return nil
+}
+
+// bindVariables turns a snippet's {{variable}} placeholders into $n parameters, numbered by
+// first use, and returns the values in matching order for bindParams. Every variable must be
+// given and nothing else.
+func bindVariables(query string, values map[string]any) (string, []any, error) {
+	vars, err := sqlparse.Variables(query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	numbers := make(map[string]int, len(vars))
+	params := make([]any, 0, len(vars))
+	var b strings.Builder
+	last := 0
+	for _, v := range vars {
+		n, ok := numbers[v.Name]
+		if !ok {
+			value, given := values[v.Name]
+			if !given {
+				return "", nil, fmt.Errorf("variable %q is not set", v.Name)
+			}
+			params = append(params, value)
+			n = len(params)
+			numbers[v.Name] = n
+		}
+		b.WriteString(query[last:v.Start])
+		fmt.Fprintf(&b, "$%d", n)
+		last = v.End
+	}
+	b.WriteString(query[last:])
+
+	for name := range values {
+		if _, ok := numbers[name]; !ok {
+			return "", nil, fmt.Errorf("snippet has no variable %q", name)
+		}
+	}
+	return b.String(), params, nil
+}
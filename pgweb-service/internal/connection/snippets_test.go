@@ -0,0 +1,103 @@
+package connection
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBindVariables(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		values map[string]any
+		want   string
+		params []any
+	}{
+		{"no variables", "SELECT 1", nil, "SELECT 1", []any{}},
+		{
+			name:   "numbered by first use",
+			query:  "SELECT * FROM t WHERE b = {{ b }} AND a = {{a}}",
+			values: map[string]any{"a": json.Number("1"), "b": "x"},
+			want:   "SELECT * FROM t WHERE b = $1 AND a = $2",
+			params: []any{"x", json.Number("1")},
+		},
+		{
+			name:   "a repeated variable is bound once",
+			query:  "SELECT * FROM t WHERE a = {{id}} OR b = {{id}} OR c = {{other}} OR d = {{ id }}",
+			values: map[string]any{"id": json.Number("7"), "other": nil},
+			want:   "SELECT * FROM t WHERE a = $1 OR b = $1 OR c = $2 OR d = $1",
+			params: []any{json.Number("7"), nil},
+		},
+		{
+			name:   "braces in strings and comments are left alone",
+			query:  "SELECT '{{a}}', {{a}} -- {{b}}",
+			values: map[string]any{"a": true},
+			want:   "SELECT '{{a}}', $1 -- {{b}}",
+			params: []any{true},
+		},
+	}
+	// Values arrive decoded with UseNumber, as in the query payload.
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, params, err := bindVariables(tt.query, tt.values)
+			if err != nil {
+				t.Fatalf("bindVariables: %v", err)
+			}
+			if query != tt.want || !reflect.DeepEqual(params, tt.params) {
+				t.Errorf("bindVariables = %q %#v, want %q %#v", query, params, tt.want, tt.params)
+			}
+			// The rewritten query must line up with its params for bindParams.
+			if _, err := bindParams(query, params); err != nil {
+				t.Errorf("bindParams on the bound snippet: %v", err)
+			}
+		})
+	}
+}
+
+func TestBindVariablesErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		values map[string]any
+		want   string
+	}{
+		{"missing variable", "SELECT {{a}}, {{b}}", map[string]any{"a": 1}, `variable "b" is not set`},
+		{"unknown variable", "SELECT {{a}}", map[string]any{"a": 1, "c": 2}, `snippet has no variable "c"`},
+		{"variable only in a comment", "SELECT 1 -- {{a}}", map[string]any{"a": 1}, `snippet has no variable "a"`},
+		{"unparsable query", "SELECT {{a}}, 'oops", map[string]any{"a": 1}, "unterminated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := bindVariables(tt.query, tt.values)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("bindVariables(%q) error = %v, want %q", tt.query, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSnippet(t *testing.T) {
+	sn := Snippet{Name: "by-id", Query: "SELECT * FROM t WHERE id = {{id}}", Tags: []string{" ops ", "Ops", "", "reports"}}
+	if err := validateSnippet(&sn); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sn.Tags, []string{"ops", "reports"}) {
+		t.Errorf("tags = %q, want trimmed and deduplicated", sn.Tags)
+	}
+
+	tests := map[string]Snippet{
+		"bad name":           {Name: "-x", Query: "SELECT 1"},
+		"empty query":        {Name: "x", Query: "  "},
+		"numbered parameter": {Name: "x", Query: "SELECT * FROM t WHERE id = $1"},
+		"unparsable query":   {Name: "x", Query: "SELECT 'oops"},
+	}
+	for name, sn := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := validateSnippet(&sn); err == nil {
+				t.Errorf("validateSnippet(%+v) succeeded, want an error", sn)
+			}
+		})
+	}
+}
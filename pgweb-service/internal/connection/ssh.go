@@ -0,0 +1,225 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	defaultSSHPort = 22
+	sshDialTimeout = 10 * time.Second
+)
+
+// SSHTunnel describes the bastion host Postgres is reached through.
+type SSHTunnel struct {
+	Host string   `json:"host"`
+	Port IntValue `json:"port,omitempty"`
+	User string   `json:"user"`
+	// PrivateKey is OpenSSH/PEM key content or the name of a key file in the server's
+	// credentials directory.
+	PrivateKey string `json:"private_key,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+	// UseAgent authenticates with the keys held by the agent at $SSH_AUTH_SOCK.
+	UseAgent bool `json:"use_agent,omitempty"`
+	// KnownHosts is known_hosts content or the name of a file in the credentials directory;
+	// it defaults to the server's ~/.ssh/known_hosts.
+	KnownHosts string `json:"known_hosts,omitempty"`
+}
+
+func (t SSHTunnel) address() string {
+	port := int(t.Port)
+	if port == 0 {
+		port = defaultSSHPort
+	}
+	return net.JoinHostPort(t.Host, strconv.Itoa(port))
+}
+
+// sshTunnel is an open SSH client that lib/pq dials Postgres through.
+type sshTunnel struct {
+	client *ssh.Client
+}
+
+// Dial implements pq.Dialer.
+func (t *sshTunnel) Dial(network, address string) (net.Conn, error) {
+	return t.client.Dial(network, address)
+}
+
+// DialTimeout implements pq.Dialer.
+func (t *sshTunnel) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return t.DialContext(ctx, network, address)
+}
+
+// DialContext implements pq.DialerContext.
+func (t *sshTunnel) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return t.client.DialContext(ctx, network, address)
+}
+
+func (t *sshTunnel) Close() error {
+	return t.client.Close()
+}
+
+// validateSSH checks that a tunnel has a target, a user, and a usable credential. Key files
+// are looked up in the credentials directory dir.
+func validateSSH(t *SSHTunnel, dir string) error {
+	if t == nil {
+		return nil
+	}
+	if t.Host == "" {
+		return errors.New("ssh.host is required")
+	}
+	if t.User == "" {
+		return errors.New("ssh.user is required")
+	}
+	if int(t.Port) < 0 {
+		return errors.New("ssh.port must be > 0")
+	}
+	if t.PrivateKey == "" && !t.UseAgent {
+		return errors.New("ssh.private_key or ssh.use_agent is required")
+	}
+	if t.PrivateKey != "" {
+		if _, err := sshSigner(*t, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sshSigner(t SSHTunnel, dir string) (ssh.Signer, error) {
+	raw := []byte(t.PrivateKey)
+	if !isPEM(t.PrivateKey) {
+		path, err := credentialPath("ssh.private_key", t.PrivateKey, dir)
+		if err != nil {
+			return nil, err
+		}
+		if raw, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("ssh.private_key: %w", err)
+		}
+	}
+
+	var (
+		signer ssh.Signer
+		err    error
+	)
+	if t.Passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(raw, []byte(t.Passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ssh.private_key: %w", err)
+	}
+	return signer, nil
+}
+
+// sshHostKeyCallback verifies the bastion against known_hosts. Inline content is written to
+// the pool's private directory because the knownhosts package only reads files; file names
+// are looked up in the credentials directory dir.
+func sshHostKeyCallback(t SSHTunnel, res *poolResources, dir string) (ssh.HostKeyCallback, error) {
+	path := t.KnownHosts
+	switch {
+	case path == "":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("ssh.known_hosts: %w", err)
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	case isKnownHostsContent(path):
+		dir, err := res.privateDir()
+		if err != nil {
+			return nil, fmt.Errorf("ssh.known_hosts: %w", err)
+		}
+		path = filepath.Join(dir, "known_hosts")
+		if err := os.WriteFile(path, []byte(t.KnownHosts), 0o600); err != nil {
+			return nil, fmt.Errorf("ssh.known_hosts: %w", err)
+		}
+	default:
+		var err error
+		if path, err = credentialPath("ssh.known_hosts", path, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("ssh.known_hosts: %w", err)
+	}
+	return callback, nil
+}
+
+// isKnownHostsContent tells known_hosts lines apart from a file path: lines always carry
+// at least a host pattern, a key type and a key separated by whitespace.
+func isKnownHostsContent(value string) bool {
+	_, _, _, _, _, err := ssh.ParseKnownHosts([]byte(value))
+	return err == nil
+}
+
+// dialSSHTunnel connects and authenticates to the bastion host. Key and known_hosts files are
+// looked up in the credentials directory dir.
+func dialSSHTunnel(ctx context.Context, t SSHTunnel, res *poolResources, dir string) (*sshTunnel, error) {
+	ctx, cancel := context.WithTimeout(ctx, sshDialTimeout)
+	defer cancel()
+
+	hostKeyCallback, err := sshHostKeyCallback(t, res, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var auth []ssh.AuthMethod
+	if t.PrivateKey != "" {
+		signer, err := sshSigner(t, dir)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if t.UseAgent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, errors.New("ssh.use_agent is set but SSH_AUTH_SOCK is empty")
+		}
+		agentConn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, fmt.Errorf("connect to ssh agent: %w", err)
+		}
+		// Signers are only needed during the handshake below.
+		defer agentConn.Close()
+		auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+	}
+
+	config := &ssh.ClientConfig{
+		User:            t.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", t.address())
+	if err != nil {
+		return nil, fmt.Errorf("dial ssh host %s: %w", t.address(), err)
+	}
+
+	// Bound the handshake by the caller's deadline as well as the TCP dial.
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, t.address(), config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssh handshake with %s: %w", t.address(), err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	return &sshTunnel{client: ssh.NewClient(clientConn, chans, reqs)}, nil
+}
@@ -0,0 +1,302 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer is an in-process bastion that accepts one client key and forwards
+// direct-tcpip channels, standing in for sshd.
+type testSSHServer struct {
+	addr    string
+	hostKey ssh.Signer
+
+	mu    sync.Mutex
+	conns []*ssh.ServerConn
+}
+
+func newTestSSHServer(t *testing.T, clientKey ssh.PublicKey) *testSSHServer {
+	t.Helper()
+
+	hostKey := newTestSigner(t)
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() == "pgweb" && bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	srv := &testSSHServer{addr: ln.Addr().String(), hostKey: hostKey}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn, config)
+		}
+	}()
+	return srv
+}
+
+func (srv *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	srv.mu.Lock()
+	srv.conns = append(srv.conns, sconn)
+	srv.mu.Unlock()
+
+	go ssh.DiscardRequests(reqs)
+	for ch := range chans {
+		if ch.ChannelType() != "direct-tcpip" {
+			ch.Reject(ssh.UnknownChannelType, "only direct-tcpip is supported")
+			continue
+		}
+		var target struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+		if err := ssh.Unmarshal(ch.ExtraData(), &target); err != nil {
+			ch.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			ch.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, requests, err := ch.Accept()
+		if err != nil {
+			upstream.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			defer channel.Close()
+			defer upstream.Close()
+			go io.Copy(upstream, channel)
+			io.Copy(channel, upstream)
+		}()
+	}
+}
+
+// waitClosed waits for every client connection to the server to go away.
+func (srv *testSSHServer) waitClosed(t *testing.T) {
+	t.Helper()
+	srv.mu.Lock()
+	conns := append([]*ssh.ServerConn(nil), srv.conns...)
+	srv.mu.Unlock()
+	if len(conns) == 0 {
+		t.Fatal("no client ever connected")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for _, c := range conns {
+			c.Wait()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ssh connection still open")
+	}
+}
+
+func (srv *testSSHServer) knownHostsLine(key ssh.PublicKey) string {
+	return knownhosts.Line([]string{knownhosts.Normalize(srv.addr)}, key) + "\n"
+}
+
+func (srv *testSSHServer) tunnelConfig(t *testing.T, privateKey, knownHosts string) SSHTunnel {
+	t.Helper()
+	host, port, err := net.SplitHostPort(srv.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(port)
+	return SSHTunnel{Host: host, Port: IntValue(n), User: "pgweb", PrivateKey: privateKey, KnownHosts: knownHosts}
+}
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// newTestClientKey returns an OpenSSH private key as a client would upload it.
+func newTestClientKey(t *testing.T) (string, ssh.PublicKey) {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(block)), sshPub
+}
+
+// startEchoServer stands in for Postgres behind the bastion.
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestSSHTunnelDialsThroughBastion(t *testing.T) {
+	privateKey, clientPub := newTestClientKey(t)
+	srv := newTestSSHServer(t, clientPub)
+	target := startEchoServer(t)
+
+	res := &poolResources{}
+	defer res.close()
+	tunnel, err := dialSSHTunnel(context.Background(), srv.tunnelConfig(t, privateKey, srv.knownHostsLine(srv.hostKey.PublicKey())), res, "")
+	if err != nil {
+		t.Fatalf("dialSSHTunnel: %v", err)
+	}
+	defer tunnel.Close()
+
+	conn, err := tunnel.DialTimeout("tcp", target, 5*time.Second)
+	if err != nil {
+		t.Fatalf("dial through tunnel: %v", err)
+	}
+	defer conn.Close()
+
+	want := []byte("SELECT 1")
+	if _, err := conn.Write(want); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("read through tunnel: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("echo through tunnel = %q, want %q", got, want)
+	}
+}
+
+func TestSSHTunnelRejectsHostKeyMismatch(t *testing.T) {
+	privateKey, clientPub := newTestClientKey(t)
+	srv := newTestSSHServer(t, clientPub)
+
+	res := &poolResources{}
+	defer res.close()
+	other := newTestSigner(t).PublicKey()
+	_, err := dialSSHTunnel(context.Background(), srv.tunnelConfig(t, privateKey, srv.knownHostsLine(other)), res, "")
+	if err == nil || !strings.Contains(err.Error(), "key mismatch") {
+		t.Fatalf("dialSSHTunnel error = %v, want a host key mismatch", err)
+	}
+}
+
+func TestSSHTunnelRejectsUnknownHost(t *testing.T) {
+	privateKey, clientPub := newTestClientKey(t)
+	srv := newTestSSHServer(t, clientPub)
+
+	res := &poolResources{}
+	defer res.close()
+	line := knownhosts.Line([]string{"bastion.example.com"}, srv.hostKey.PublicKey()) + "\n"
+	_, err := dialSSHTunnel(context.Background(), srv.tunnelConfig(t, privateKey, line), res, "")
+	if err == nil || !strings.Contains(err.Error(), "key is unknown") {
+		t.Fatalf("dialSSHTunnel error = %v, want an unknown host error", err)
+	}
+}
+
+func TestCloseTearsDownSSHTunnel(t *testing.T) {
+	privateKey, clientPub := newTestClientKey(t)
+	srv := newTestSSHServer(t, clientPub)
+	target := startEchoServer(t)
+
+	res := &poolResources{}
+	tunnel, err := dialSSHTunnel(context.Background(), srv.tunnelConfig(t, privateKey, srv.knownHostsLine(srv.hostKey.PublicKey())), res, "")
+	if err != nil {
+		t.Fatalf("dialSSHTunnel: %v", err)
+	}
+	res.tunnel = tunnel
+
+	connector, err := pq.NewConnector("host=db.internal dbname=app sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector.Dialer(tunnel)
+	s, err := newSession(Connection{Host: "db.internal", Database: "app"}, "", sql.OpenDB(connector), res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &ConnectionHandler{sessions: map[string]*session{s.id: s}}
+
+	req := httptest.NewRequest(http.MethodPost, "/close", nil)
+	req.Header.Set(sessionHeaderName, s.id)
+	rec := httptest.NewRecorder()
+	h.CloseConnection(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/close = %d %s", rec.Code, rec.Body)
+	}
+
+	srv.waitClosed(t)
+	if _, err := tunnel.DialTimeout("tcp", target, time.Second); err == nil {
+		t.Error("tunnel still dials after /close")
+	}
+	if len(h.sessions) != 0 {
+		t.Error("session still registered after /close")
+	}
+}
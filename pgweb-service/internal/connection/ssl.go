@@ -0,0 +1,156 @@
+package connection
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isPEM reports whether an sslrootcert/sslcert/sslkey value is uploaded PEM content rather
+// than a path to a file on the API server.
+func isPEM(value string) bool {
+	return strings.Contains(value, "-----BEGIN ")
+}
+
+// credentialPath resolves a certificate, key or known_hosts value naming a file on the API
+// server. Only files inside dir (PGWEB_CREDENTIALS_DIR) are accepted, so clients can't make
+// the server use its own keys or probe its filesystem through error messages; relative names
+// are taken relative to dir. Without dir, file paths are refused altogether.
+func credentialPath(field, value, dir string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("%s: file paths are not accepted; upload the content instead", field)
+	}
+	outside := fmt.Errorf("%s: file must be in the server's credentials directory", field)
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("%s: credentials directory: %w", field, err)
+	}
+	path := filepath.Clean(value)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	// Check the name before touching the filesystem, then again once symlinks are resolved.
+	if !withinDir(root, path) {
+		return "", outside
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", fmt.Errorf("%s: credentials directory: %w", field, err)
+	}
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return "", fmt.Errorf("%s: %s not found in the credentials directory", field, value)
+	}
+	if !withinDir(root, path) {
+		return "", outside
+	}
+	return path, nil
+}
+
+// withinDir reports whether path lies strictly below dir; both must be clean absolute paths.
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// readSSLMaterial returns the PEM bytes for a value that is either inline PEM or the name of
+// a file in the credentials directory dir.
+func readSSLMaterial(field, value, dir string) ([]byte, error) {
+	if isPEM(value) {
+		return []byte(value), nil
+	}
+	path, err := credentialPath(field, value, dir)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", field, err)
+	}
+	return raw, nil
+}
+
+// validateSSL checks the sslmode and that any certificate material parses. File paths are
+// looked up in the credentials directory dir.
+func validateSSL(c Connection, dir string) error {
+	if !c.SSLMode.Valid() {
+		return fmt.Errorf("unsupported ssl_mode %q; use disable, allow, prefer, require, verify-ca or verify-full", c.SSLMode)
+	}
+
+	hasMaterial := c.SSLRootCert != "" || c.SSLCert != "" || c.SSLKey != ""
+	if hasMaterial && c.SSLMode.Effective() == SSLModeDisable {
+		return errors.New("ssl certificates were provided but ssl_mode is disable")
+	}
+	if (c.SSLCert == "") != (c.SSLKey == "") {
+		return errors.New("ssl_cert and ssl_key must be provided together")
+	}
+
+	if c.SSLRootCert != "" {
+		raw, err := readSSLMaterial("ssl_root_cert", c.SSLRootCert, dir)
+		if err != nil {
+			return err
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(raw) {
+			return errors.New("ssl_root_cert: no PEM certificates found")
+		}
+	}
+
+	if c.SSLCert != "" {
+		cert, err := readSSLMaterial("ssl_cert", c.SSLCert, dir)
+		if err != nil {
+			return err
+		}
+		key, err := readSSLMaterial("ssl_key", c.SSLKey, dir)
+		if err != nil {
+			return err
+		}
+		if _, err := tls.X509KeyPair(cert, key); err != nil {
+			return fmt.Errorf("ssl_cert/ssl_key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// materializeSSL writes uploaded PEM material into private files in the pool's directory and
+// resolves file names against the credentials directory credentialsDir, returning a copy of c
+// pointing at the files. lib/pq reads certificates from disk (its sslinline mode cannot express
+// a root certificate without a client certificate), so uploads need a file for the pool's lifetime.
+func materializeSSL(c Connection, res *poolResources, credentialsDir string) (Connection, error) {
+	fields := []struct {
+		value *string
+		field string
+		name  string
+	}{
+		{&c.SSLRootCert, "ssl_root_cert", "root.crt"},
+		{&c.SSLCert, "ssl_cert", "client.crt"},
+		{&c.SSLKey, "ssl_key", "client.key"},
+	}
+
+	for _, f := range fields {
+		if *f.value == "" {
+			continue
+		}
+		if !isPEM(*f.value) {
+			path, err := credentialPath(f.field, *f.value, credentialsDir)
+			if err != nil {
+				return Connection{}, err
+			}
+			*f.value = path
+			continue
+		}
+		dir, err := res.privateDir()
+		if err != nil {
+			return Connection{}, err
+		}
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, []byte(*f.value), 0o600); err != nil {
+			return Connection{}, fmt.Errorf("write %s: %w", f.name, err)
+		}
+		*f.value = path
+	}
+	return c, nil
+}
@@ -0,0 +1,70 @@
+package connection
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCredentialPath(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "client.crt")
+	if err := os.WriteFile(cert, []byte("cert"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc/passwd", filepath.Join(dir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := filepath.EvalSymlinks(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		dir     string
+		want    string
+		wantErr string
+	}{
+		{name: "relative name", value: "client.crt", dir: dir, want: resolved},
+		{name: "absolute path inside", value: cert, dir: dir, want: resolved},
+		{name: "dot segments staying inside", value: "sub/../client.crt", dir: dir, want: resolved},
+		{name: "parent directory", value: "../client.crt", dir: dir, wantErr: "credentials directory"},
+		{name: "absolute path outside", value: "/etc/passwd", dir: dir, wantErr: "credentials directory"},
+		{name: "symlink leading outside", value: "escape", dir: dir, wantErr: "credentials directory"},
+		{name: "the directory itself", value: dir, dir: dir, wantErr: "credentials directory"},
+		{name: "missing file", value: "missing.crt", dir: dir, wantErr: "not found"},
+		{name: "no directory configured", value: cert, dir: "", wantErr: "upload the content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := credentialPath("ssl_cert", tt.value, tt.dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("credentialPath(%q) error = %v, want one containing %q", tt.value, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("credentialPath(%q): %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("credentialPath(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSSLMaterialOutsideDirDoesNotLeakExistence(t *testing.T) {
+	dir := t.TempDir()
+	_, existing := readSSLMaterial("ssl_root_cert", "/etc/passwd", dir)
+	_, missing := readSSLMaterial("ssl_root_cert", "/etc/does-not-exist", dir)
+	if existing == nil || missing == nil {
+		t.Fatal("paths outside the credentials directory must be rejected")
+	}
+	if existing.Error() != missing.Error() {
+		t.Errorf("errors differ for existing and missing files: %q vs %q", existing, missing)
+	}
+}
@@ -0,0 +1,357 @@
+package connection
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const defaultTableDataLimit = 100
+
+// tableDataQuery is a parsed GET /schemas/{schema}/tables/{table}/data request.
+type tableDataQuery struct {
+	columns []string
+	order   []orderTerm
+	filters []columnFilter
+	limit   int
+	offset  int
+	cursor  []*string
+	count   string
+}
+
+type orderTerm struct {
+	Column   string
+	Desc     bool
+	Nullable bool
+}
+
+func (o orderTerm) String() string {
+	if o.Desc {
+		return o.Column + ":desc"
+	}
+	return o.Column + ":asc"
+}
+
+type columnFilter struct {
+	column string
+	op     string
+	values []string
+}
+
+// tableCursor is the opaque keyset cursor handed out as next_cursor: the ORDER BY it belongs
+// to plus the text form of the last row's order values.
+type tableCursor struct {
+	Order  []string  `json:"o"`
+	Values []*string `json:"v"`
+}
+
+// parseTableDataQuery reads the paging, ordering, projection and filter parameters:
+//
+//	limit=100&offset=200 | cursor=<next_cursor>
+//	order_by=created_at:desc&order_by=id
+//	columns=id,name
+//	filter=name:like:A%&filter=deleted_at:is_null:true&filter=id:in:1,2,3
+//	count=estimated|exact|none
+//
+// Rows are always ordered by the requested columns followed by the table's key, so pages are
+// stable. NULLs sort last ascending and first descending, and cursors carry them along, so
+// keyset pages neither skip nor repeat rows with NULL order values.
+func parseTableDataQuery(params url.Values, columns []tableColumn, key tableKey, maxLimit int) (tableDataQuery, error) {
+	q := tableDataQuery{limit: defaultTableDataLimit, count: "estimated"}
+
+	known := make(map[string]tableColumn, len(columns))
+	for _, c := range columns {
+		known[c.Name] = c
+	}
+	checkColumn := func(name string) error {
+		if _, ok := known[name]; !ok {
+			return fmt.Errorf("unknown column %q", name)
+		}
+		return nil
+	}
+
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return q, errors.New("limit must be a positive integer")
+		}
+		if n > maxLimit {
+			return q, fmt.Errorf("limit must be at most %d", maxLimit)
+		}
+		q.limit = n
+	}
+	if v := params.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return q, errors.New("offset must be a non-negative integer")
+		}
+		q.offset = n
+	}
+
+	for _, list := range params["columns"] {
+		for _, name := range strings.Split(list, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if err := checkColumn(name); err != nil {
+				return q, err
+			}
+			q.columns = append(q.columns, name)
+		}
+	}
+	if len(q.columns) == 0 {
+		for _, c := range columns {
+			q.columns = append(q.columns, c.Name)
+		}
+	}
+
+	ordered := make(map[string]bool)
+	for _, spec := range params["order_by"] {
+		term := orderTerm{Column: spec}
+		if i := strings.LastIndex(spec, ":"); i >= 0 {
+			switch strings.ToLower(spec[i+1:]) {
+			case "asc":
+				term.Column = spec[:i]
+			case "desc":
+				term = orderTerm{Column: spec[:i], Desc: true}
+			}
+		}
+		if err := checkColumn(term.Column); err != nil {
+			return q, err
+		}
+		if ordered[term.Column] {
+			continue
+		}
+		ordered[term.Column] = true
+		term.Nullable = known[term.Column].Nullable
+		q.order = append(q.order, term)
+	}
+	// Key columns are NOT NULL, lookupTableKey only picks such keys.
+	for _, name := range key.Columns {
+		if !ordered[name] {
+			q.order = append(q.order, orderTerm{Column: name})
+		}
+	}
+
+	for _, spec := range params["filter"] {
+		parts := strings.SplitN(spec, ":", 3)
+		if len(parts) != 3 {
+			return q, fmt.Errorf("filter %q must look like column:op:value", spec)
+		}
+		if err := checkColumn(parts[0]); err != nil {
+			return q, err
+		}
+		f := columnFilter{column: parts[0], op: parts[1], values: []string{parts[2]}}
+		switch f.op {
+		case "eq", "ne", "lt", "le", "gt", "ge", "like":
+		case "is_null":
+			if _, err := strconv.ParseBool(parts[2]); err != nil {
+				return q, fmt.Errorf("is_null filter on %q needs true or false", f.column)
+			}
+		case "in":
+			f.values = strings.Split(parts[2], ",")
+		default:
+			return q, fmt.Errorf("unknown filter operator %q", f.op)
+		}
+		q.filters = append(q.filters, f)
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		if q.offset > 0 {
+			return q, errors.New("cursor and offset are mutually exclusive")
+		}
+		if len(key.Columns) == 0 {
+			return q, errors.New("cursor paging needs a table with a primary or unique key")
+		}
+		raw, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			return q, errors.New("malformed cursor")
+		}
+		var c tableCursor
+		if err := json.Unmarshal(raw, &c); err != nil || len(c.Values) != len(c.Order) {
+			return q, errors.New("malformed cursor")
+		}
+		if strings.Join(c.Order, ",") != strings.Join(q.orderSpec(), ",") {
+			return q, errors.New("cursor does not match order_by")
+		}
+		q.cursor = c.Values
+	}
+
+	switch v := params.Get("count"); v {
+	case "":
+	case "estimated", "exact", "none":
+		q.count = v
+	default:
+		return q, errors.New("count must be estimated, exact or none")
+	}
+
+	return q, nil
+}
+
+func (q tableDataQuery) orderSpec() []string {
+	spec := make([]string, len(q.order))
+	for i, o := range q.order {
+		spec[i] = o.String()
+	}
+	return spec
+}
+
+// where builds the WHERE clause for the filters, appending bind values to args.
+func (q tableDataQuery) where(args *[]any, withCursor bool) (string, error) {
+	bind := func(v any) string {
+		*args = append(*args, v)
+		return "$" + strconv.Itoa(len(*args))
+	}
+
+	conds := make([]string, 0, len(q.filters)+1)
+	for _, f := range q.filters {
+		col := pq.QuoteIdentifier(f.column)
+		switch f.op {
+		case "eq":
+			conds = append(conds, col+" = "+bind(f.values[0]))
+		case "ne":
+			conds = append(conds, col+" IS DISTINCT FROM "+bind(f.values[0]))
+		case "lt":
+			conds = append(conds, col+" < "+bind(f.values[0]))
+		case "le":
+			conds = append(conds, col+" <= "+bind(f.values[0]))
+		case "gt":
+			conds = append(conds, col+" > "+bind(f.values[0]))
+		case "ge":
+			conds = append(conds, col+" >= "+bind(f.values[0]))
+		case "like":
+			conds = append(conds, col+"::text LIKE "+bind(f.values[0]))
+		case "is_null":
+			if isNull, _ := strconv.ParseBool(f.values[0]); isNull {
+				conds = append(conds, col+" IS NULL")
+			} else {
+				conds = append(conds, col+" IS NOT NULL")
+			}
+		case "in":
+			placeholders := make([]string, len(f.values))
+			for i, v := range f.values {
+				placeholders[i] = bind(v)
+			}
+			conds = append(conds, col+" IN ("+strings.Join(placeholders, ", ")+")")
+		}
+	}
+
+	if withCursor && q.cursor != nil {
+		// (a, b) after (x, y) in mixed directions: a > x OR (a = x AND b > y), where NULL
+		// equals NULL and sorts after every value ascending and before every value descending.
+		params := make([]string, len(q.cursor))
+		for i, v := range q.cursor {
+			if v != nil {
+				params[i] = bind(*v)
+			}
+		}
+		equal := func(i int) string {
+			col := pq.QuoteIdentifier(q.order[i].Column)
+			if q.cursor[i] == nil {
+				return col + " IS NULL"
+			}
+			return col + " = " + params[i]
+		}
+		after := func(i int) string {
+			o := q.order[i]
+			col := pq.QuoteIdentifier(o.Column)
+			switch {
+			case o.Desc && q.cursor[i] == nil:
+				return col + " IS NOT NULL"
+			case o.Desc:
+				return col + " < " + params[i]
+			case q.cursor[i] == nil:
+				// Nothing sorts after a NULL ascending.
+				return ""
+			case o.Nullable:
+				return "(" + col + " > " + params[i] + " OR " + col + " IS NULL)"
+			default:
+				return col + " > " + params[i]
+			}
+		}
+		alternatives := make([]string, 0, len(q.order))
+		for i := range q.order {
+			last := after(i)
+			if last == "" {
+				continue
+			}
+			terms := make([]string, 0, i+1)
+			for j := 0; j < i; j++ {
+				terms = append(terms, equal(j))
+			}
+			terms = append(terms, last)
+			alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+		}
+		if len(alternatives) == 0 {
+			alternatives = append(alternatives, "FALSE")
+		}
+		conds = append(conds, "("+strings.Join(alternatives, " OR ")+")")
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), nil
+}
+
+// selectSQL builds the page query. Besides the projected columns it selects the text form of
+// every order column, used to build next_cursor, and fetches one extra row to detect whether
+// there is a next page.
+func (q tableDataQuery) selectSQL(from string) (string, []any, error) {
+	args := make([]any, 0)
+	where, err := q.where(&args, true)
+	if err != nil {
+		return "", nil, err
+	}
+
+	selected := make([]string, 0, len(q.columns)+len(q.order))
+	for _, c := range q.columns {
+		selected = append(selected, pq.QuoteIdentifier(c))
+	}
+	order := make([]string, len(q.order))
+	for i, o := range q.order {
+		selected = append(selected, pq.QuoteIdentifier(o.Column)+"::text")
+		order[i] = pq.QuoteIdentifier(o.Column)
+		if o.Desc {
+			order[i] += " DESC"
+		}
+		// Spelled out because where's cursor conditions depend on it.
+		if o.Nullable && o.Desc {
+			order[i] += " NULLS FIRST"
+		} else if o.Nullable {
+			order[i] += " NULLS LAST"
+		}
+	}
+
+	query := "SELECT " + strings.Join(selected, ", ") + " FROM " + from + where
+	if len(order) > 0 {
+		query += " ORDER BY " + strings.Join(order, ", ")
+	}
+	query += fmt.Sprintf(" LIMIT %d OFFSET %d", q.limit+1, q.offset)
+	return query, args, nil
+}
+
+// countSQL builds the count query over the filtered table, ignoring paging.
+func (q tableDataQuery) countSQL(from string) (string, []any, error) {
+	args := make([]any, 0)
+	where, err := q.where(&args, false)
+	if err != nil {
+		return "", nil, err
+	}
+	if q.count == "exact" {
+		return "SELECT count(*) FROM " + from + where, args, nil
+	}
+	return "EXPLAIN (FORMAT JSON) SELECT 1 FROM " + from + where, args, nil
+}
+
+func encodeTableCursor(order []string, values []*string) string {
+	raw, _ := json.Marshal(tableCursor{Order: order, Values: values})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
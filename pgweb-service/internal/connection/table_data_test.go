@@ -0,0 +1,214 @@
+package connection
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testTableColumns = []tableColumn{
+	{Name: "id", Type: "integer"},
+	{Name: "name", Type: "text", Nullable: true},
+	{Name: "created_at", Type: "timestamp with time zone"},
+}
+
+func TestParseTableDataQuery(t *testing.T) {
+	pk := tableKey{Columns: []string{"id"}, Primary: true}
+	tests := []struct {
+		name  string
+		query string
+		key   tableKey
+		want  tableDataQuery
+		sql   string
+		args  []any
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			key:   pk,
+			want:  tableDataQuery{columns: []string{"id", "name", "created_at"}, order: []orderTerm{{Column: "id"}}, limit: 100, count: "estimated"},
+			sql:   `SELECT "id", "name", "created_at", "id"::text FROM t ORDER BY "id" LIMIT 101 OFFSET 0`,
+			args:  []any{},
+		},
+		{
+			name:  "projection, order and paging",
+			query: "columns=name,+id&order_by=created_at:desc&order_by=name:ASC&order_by=created_at&limit=10&offset=20&count=exact",
+			key:   pk,
+			want: tableDataQuery{
+				columns: []string{"name", "id"},
+				order:   []orderTerm{{Column: "created_at", Desc: true}, {Column: "name", Nullable: true}, {Column: "id"}},
+				limit:   10, offset: 20, count: "exact",
+			},
+			sql:  `SELECT "name", "id", "created_at"::text, "name"::text, "id"::text FROM t ORDER BY "created_at" DESC, "name" NULLS LAST, "id" LIMIT 11 OFFSET 20`,
+			args: []any{},
+		},
+		{
+			name:  "filters",
+			query: "columns=id&filter=name:like:A%25&filter=created_at:is_null:false&filter=id:in:1,2,3&filter=name:ne:x:y",
+			key:   tableKey{},
+			want: tableDataQuery{
+				columns: []string{"id"},
+				filters: []columnFilter{
+					{column: "name", op: "like", values: []string{"A%"}},
+					{column: "created_at", op: "is_null", values: []string{"false"}},
+					{column: "id", op: "in", values: []string{"1", "2", "3"}},
+					{column: "name", op: "ne", values: []string{"x:y"}},
+				},
+				limit: 100, count: "estimated",
+			},
+			sql:  `SELECT "id" FROM t WHERE "name"::text LIKE $1 AND "created_at" IS NOT NULL AND "id" IN ($2, $3, $4) AND "name" IS DISTINCT FROM $5 LIMIT 101 OFFSET 0`,
+			args: []any{"A%", "1", "2", "3", "x:y"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseTableDataQuery(params, testTableColumns, tt.key, 1000)
+			if err != nil {
+				t.Fatalf("parseTableDataQuery(%q): %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTableDataQuery(%q) =\n%+v\nwant\n%+v", tt.query, got, tt.want)
+			}
+			query, args, err := got.selectSQL("t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query != tt.sql || !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("selectSQL =\n%s %v\nwant\n%s %v", query, args, tt.sql, tt.args)
+			}
+		})
+	}
+}
+
+func TestParseTableDataQueryCursor(t *testing.T) {
+	pk := tableKey{Columns: []string{"id"}, Primary: true}
+	first, err := parseTableDataQuery(url.Values{"order_by": {"name:desc"}}, testTableColumns, pk, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, id := "bob", "7"
+	cursor := encodeTableCursor(first.orderSpec(), []*string{&name, &id})
+
+	next, err := parseTableDataQuery(url.Values{"order_by": {"name:desc"}, "cursor": {cursor}}, testTableColumns, pk, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, args, err := next.selectSQL("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantWhere := ` WHERE (("name" < $1) OR ("name" = $1 AND "id" > $2))`
+	if !strings.Contains(query, wantWhere) || !reflect.DeepEqual(args, []any{"bob", "7"}) {
+		t.Errorf("selectSQL with cursor = %s %v, want WHERE %s", query, args, wantWhere)
+	}
+
+	// The count ignores the cursor but keeps the filters.
+	count, countArgs, err := next.countSQL("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != "EXPLAIN (FORMAT JSON) SELECT 1 FROM t" || len(countArgs) != 0 {
+		t.Errorf("countSQL = %s %v", count, countArgs)
+	}
+
+	if _, err := parseTableDataQuery(url.Values{"cursor": {cursor}}, testTableColumns, pk, 1000); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("cursor reused with a different order: %v, want a mismatch error", err)
+	}
+}
+
+func TestParseTableDataQueryErrors(t *testing.T) {
+	pk := tableKey{Columns: []string{"id"}, Primary: true}
+	mismatched := encodeTableCursor([]string{"id:asc"}, nil)
+	tests := []struct {
+		name  string
+		query string
+		key   tableKey
+		want  string
+	}{
+		{"zero limit", "limit=0", pk, "positive integer"},
+		{"limit above the maximum", "limit=1001", pk, "at most 1000"},
+		{"negative offset", "offset=-1", pk, "non-negative"},
+		{"unknown projected column", "columns=id,nope", pk, `unknown column "nope"`},
+		{"unknown order column", "order_by=nope:desc", pk, `unknown column "nope"`},
+		{"unknown filter column", "filter=nope:eq:1", pk, `unknown column "nope"`},
+		{"filter without a value", "filter=id:eq", pk, "column:op:value"},
+		{"unknown operator", "filter=id:regex:1", pk, "unknown filter operator"},
+		{"is_null needs a bool", "filter=name:is_null:maybe", pk, "true or false"},
+		{"cursor with offset", "cursor=x&offset=5", pk, "mutually exclusive"},
+		{"cursor without a key", "cursor=x", tableKey{}, "primary or unique key"},
+		{"malformed cursor", "cursor=!!", pk, "malformed cursor"},
+		{"cursor with the wrong number of values", "cursor=" + mismatched, pk, "malformed cursor"},
+		{"bad count", "count=some", pk, "count must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = parseTableDataQuery(params, testTableColumns, tt.key, 1000)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseTableDataQuery(%q) error = %v, want %q", tt.query, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableCursorNullOrderValues(t *testing.T) {
+	pk := tableKey{Columns: []string{"id"}, Primary: true}
+	bob, id := "bob", "7"
+	tests := []struct {
+		name   string
+		order  string
+		values []*string
+		where  string
+		args   []any
+	}{
+		{
+			name:   "ascending after a value",
+			order:  "name",
+			values: []*string{&bob, &id},
+			where:  ` WHERE ((("name" > $1 OR "name" IS NULL)) OR ("name" = $1 AND "id" > $2))`,
+			args:   []any{"bob", "7"},
+		},
+		{
+			name:   "ascending after NULL",
+			order:  "name",
+			values: []*string{nil, &id},
+			where:  ` WHERE (("name" IS NULL AND "id" > $1))`,
+			args:   []any{"7"},
+		},
+		{
+			name:   "descending after NULL",
+			order:  "name:desc",
+			values: []*string{nil, &id},
+			where:  ` WHERE (("name" IS NOT NULL) OR ("name" IS NULL AND "id" > $1))`,
+			args:   []any{"7"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, err := parseTableDataQuery(url.Values{"order_by": {tt.order}}, testTableColumns, pk, 1000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cursor := encodeTableCursor(first.orderSpec(), tt.values)
+			next, err := parseTableDataQuery(url.Values{"order_by": {tt.order}, "cursor": {cursor}}, testTableColumns, pk, 1000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query, args, err := next.selectSQL("t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(query, tt.where) || !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("selectSQL = %s %v, want%s %v", query, args, tt.where, tt.args)
+			}
+		})
+	}
+}
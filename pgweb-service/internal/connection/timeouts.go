@@ -0,0 +1,98 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// resolveTimeout picks the deadline for a request: an explicit timeout_ms wins, then the
+// connection's statement_timeout_ms, then def. Anything above the server maximum is refused.
+func (h *ConnectionHandler) resolveTimeout(requestedMS int, conn Connection, def time.Duration) (time.Duration, error) {
+	timeout := def
+	switch {
+	case requestedMS < 0:
+		return 0, fmt.Errorf("timeout_ms must be >= 0")
+	case requestedMS > 0:
+		timeout = time.Duration(requestedMS) * time.Millisecond
+	case conn.StatementTimeout > 0:
+		timeout = time.Duration(conn.StatementTimeout) * time.Millisecond
+	}
+
+	if timeout > h.cfg.MaxQueryTimeout {
+		return 0, fmt.Errorf("timeout of %s exceeds the server maximum of %s", timeout, h.cfg.MaxQueryTimeout)
+	}
+	return timeout, nil
+}
+
+// requestContext derives a context for a catalog request, honouring an optional ?timeout_ms=
+// query parameter. It writes a 400 and returns false when the parameter is invalid.
+func (h *ConnectionHandler) requestContext(w http.ResponseWriter, req *http.Request, conn Connection, def time.Duration) (context.Context, context.CancelFunc, bool) {
+	requestedMS := 0
+	if raw := req.URL.Query().Get("timeout_ms"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "Invalid timeout_ms: "+err.Error(), http.StatusBadRequest)
+			return nil, nil, false
+		}
+		requestedMS = n
+	}
+
+	timeout, err := h.resolveTimeout(requestedMS, conn, def)
+	if err != nil {
+		http.Error(w, "Invalid timeout: "+err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	return ctx, cancel, true
+}
+
+// acquireQueryConn pins a pooled connection for one request and sets its server-side
+// statement_timeout, so Postgres stops the statement even if the client goes away.
+// The returned release func resets the session state before handing the connection back.
+func acquireQueryConn(ctx context.Context, db *sql.DB, timeout time.Duration) (*sql.Conn, func(), error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := conn.ExecContext(ctx, `SELECT set_config('statement_timeout', $1, false)`,
+		strconv.FormatInt(timeout.Milliseconds(), 10)); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("set statement_timeout: %w", err)
+	}
+
+	release := func() {
+		discardSessionState(conn)
+		conn.Close()
+	}
+	return conn, release, nil
+}
+
+// discardSessionState runs DISCARD ALL on a connection about to go back to the pool, so that
+// settings changed by the caller's SQL — search_path, role, or read-only mode switched off
+// through set_config — don't carry over to later requests. Settings given at connect time,
+// such as default_transaction_read_only, are restored to their startup values. A connection
+// that can't be reset, for instance because a script left a transaction open, is discarded.
+func discardSessionState(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := conn.ExecContext(ctx, `DISCARD ALL`); err != nil {
+		log.Printf("Discarding connection after failed session reset: %v", err)
+		_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+}
+
+// setTransactionTimeout sets statement_timeout for the rest of an interactive transaction.
+// It fails harmlessly when the transaction is already aborted; the only statements left to
+// run then are ROLLBACK TO SAVEPOINT and the like.
+func setTransactionTimeout(ctx context.Context, conn *sql.Conn, timeout time.Duration) {
+	_, _ = conn.ExecContext(ctx, `SELECT set_config('statement_timeout', $1, true)`,
+		strconv.FormatInt(timeout.Milliseconds(), 10))
+}
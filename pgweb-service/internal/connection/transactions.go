@@ -0,0 +1,372 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pgweb-service/internal/sqlparse"
+	"pgweb-service/internal/util"
+
+	"github.com/lib/pq"
+)
+
+var (
+	errTransactionNotFound = errors.New("transaction not found")
+	errTransactionBusy     = errors.New("transaction is busy with another request")
+)
+
+// transaction is an open BEGIN pinned to one pooled connection. Requests take mu for as long
+// as they use conn, so statements inside one transaction never interleave.
+type transaction struct {
+	ID        string
+	PID       int
+	Isolation string
+	ReadOnly  bool
+	StartedAt time.Time
+	conn      *sql.Conn
+	mu        sync.Mutex
+	lastUsed  atomic.Int64 // unix nanoseconds
+}
+
+func (t *transaction) touch() {
+	t.lastUsed.Store(time.Now().UnixNano())
+}
+
+func (t *transaction) idleSince(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, t.lastUsed.Load()))
+}
+
+// end sends COMMIT or ROLLBACK and returns the connection to the pool, reporting the
+// server's command tag: COMMIT of a failed transaction comes back as ROLLBACK. A connection
+// whose transaction state is unknown after an error is discarded instead.
+func (t *transaction) end(ctx context.Context, statement string) (string, error) {
+	res, err := execStatement(ctx, t.conn, statement, nil, nil, nil)
+	if err != nil {
+		_ = t.conn.Raw(func(any) error { return driver.ErrBadConn })
+	} else {
+		// SET without LOCAL outlives the transaction.
+		discardSessionState(t.conn)
+	}
+	t.conn.Close()
+	return res.Tag, err
+}
+
+// transactions tracks a session's open interactive transactions.
+type transactions struct {
+	mu   sync.Mutex
+	byID map[string]*transaction
+}
+
+func newTransactions() *transactions {
+	return &transactions{byID: make(map[string]*transaction)}
+}
+
+func (ts *transactions) add(t *transaction) {
+	ts.mu.Lock()
+	ts.byID[t.ID] = t
+	ts.mu.Unlock()
+}
+
+// acquire locks the transaction for the caller's exclusive use and returns a func that
+// unlocks it again.
+func (ts *transactions) acquire(id string) (*transaction, func(), error) {
+	ts.mu.Lock()
+	t, ok := ts.byID[id]
+	ts.mu.Unlock()
+	if !ok {
+		return nil, nil, errTransactionNotFound
+	}
+	if !t.mu.TryLock() {
+		return nil, nil, errTransactionBusy
+	}
+
+	// It may have been ended between the lookup and taking the lock.
+	ts.mu.Lock()
+	_, ok = ts.byID[id]
+	ts.mu.Unlock()
+	if !ok {
+		t.mu.Unlock()
+		return nil, nil, errTransactionNotFound
+	}
+
+	t.touch()
+	return t, func() {
+		t.touch()
+		t.mu.Unlock()
+	}, nil
+}
+
+// remove forgets a transaction the caller holds the lock for.
+func (ts *transactions) remove(id string) {
+	ts.mu.Lock()
+	delete(ts.byID, id)
+	ts.mu.Unlock()
+}
+
+func (ts *transactions) list() []*transaction {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	list := make([]*transaction, 0, len(ts.byID))
+	for _, t := range ts.byID {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.Before(list[j].StartedAt) })
+	return list
+}
+
+// rollbackIdle rolls back transactions that have been idle for at least timeout, or all of
+// them when timeout is zero. Transactions busy with a request are left alone.
+func (ts *transactions) rollbackIdle(now time.Time, timeout time.Duration) {
+	for _, t := range ts.list() {
+		if timeout > 0 && t.idleSince(now) < timeout {
+			continue
+		}
+		if !t.mu.TryLock() {
+			continue
+		}
+		ts.remove(t.ID)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if _, err := t.end(ctx, "ROLLBACK"); err != nil {
+			log.Printf("Error rolling back idle transaction %s: %v", t.ID, err)
+		} else {
+			log.Printf("Rolled back idle transaction %s", t.ID)
+		}
+		cancel()
+		t.mu.Unlock()
+	}
+}
+
+func transactionView(t *transaction, now time.Time) map[string]any {
+	return map[string]any{
+		"id":         t.ID,
+		"pid":        t.PID,
+		"isolation":  t.Isolation,
+		"read_only":  t.ReadOnly,
+		"started_at": t.StartedAt,
+		"idle_ms":    t.idleSince(now).Milliseconds(),
+	}
+}
+
+// isTransactionControl reports whether sql would begin or end a transaction on its own,
+// which would desynchronise the server from the tracked transaction. ROLLBACK TO SAVEPOINT
+// and friends stay allowed.
+func isTransactionControl(sql string) (bool, error) {
+	statements, err := sqlparse.Split(sql)
+	if err != nil {
+		return false, err
+	}
+
+	for _, st := range statements {
+		if len(st.Tokens) == 0 || st.Tokens[0].Kind != sqlparse.Word {
+			continue
+		}
+		next := ""
+		if len(st.Tokens) > 1 && st.Tokens[1].Kind == sqlparse.Word {
+			next = st.Tokens[1].Value
+		}
+		switch st.Tokens[0].Value {
+		case "begin", "start", "commit", "end", "abort":
+			return true, nil
+		case "rollback":
+			if next != "to" {
+				return true, nil
+			}
+		case "prepare":
+			if next == "transaction" {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Transactions handles GET (list) and POST (begin) on /transactions. A new transaction pins a
+// pooled connection to the session until it is committed, rolled back, or rolled back for
+// being idle longer than PGWEB_TRANSACTION_IDLE_TIMEOUT.
+func (h *ConnectionHandler) Transactions(w http.ResponseWriter, req *http.Request) {
+	s, ok := h.ensureSession(w, req)
+	if !ok {
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		now := time.Now()
+		list := s.transactions.list()
+		items := make([]map[string]any, 0, len(list))
+		for _, t := range list {
+			items = append(items, transactionView(t, now))
+		}
+		util.WriteJSON(w, http.StatusOK, map[string]any{"transactions": items})
+	case http.MethodPost:
+		var payload struct {
+			Isolation string    `json:"isolation"`
+			ReadOnly  BoolValue `json:"read_only"`
+		}
+		// The body is optional.
+		if err := util.DecodeJsonBody(req).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Failed to decode request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		begin := "BEGIN"
+		switch strings.ToLower(payload.Isolation) {
+		case "":
+		case "read committed", "repeatable read", "serializable":
+			begin += " ISOLATION LEVEL " + strings.ToUpper(payload.Isolation)
+		default:
+			http.Error(w, "isolation must be read committed, repeatable read or serializable", http.StatusBadRequest)
+			return
+		}
+		if payload.ReadOnly {
+			begin += " READ ONLY"
+		}
+
+		ctx, cancel, ok := h.requestContext(w, req, s.connection, h.cfg.QueryTimeout)
+		if !ok {
+			return
+		}
+		defer cancel()
+
+		t, err := beginTransaction(ctx, s.db, begin)
+		if err != nil {
+			http.Error(w, "Failed to begin transaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		t.Isolation = strings.ToLower(payload.Isolation)
+		t.ReadOnly = bool(payload.ReadOnly)
+		s.transactions.add(t)
+
+		view := transactionView(t, time.Now())
+		view["idle_timeout_ms"] = h.cfg.TransactionIdleTimeout.Milliseconds()
+		util.WriteJSON(w, http.StatusCreated, view)
+	default:
+		http.Error(w, "This endpoint accepts only GET and POST calls", http.StatusMethodNotAllowed)
+	}
+}
+
+func beginTransaction(ctx context.Context, db *sql.DB, begin string) (*transaction, error) {
+	id, err := randomID(8)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pid, err := backendPID(ctx, conn)
+	if err == nil {
+		_, err = conn.ExecContext(ctx, begin)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	t := &transaction{ID: id, PID: pid, StartedAt: time.Now(), conn: conn}
+	t.touch()
+	return t, nil
+}
+
+// TransactionAction handles POST /transactions/{id}/{action}: commit, rollback, and the
+// savepoint operations, which take {"name": "..."}: savepoint, rollback_to and release.
+func (h *ConnectionHandler) TransactionAction(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "This endpoint accepts only POST calls", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, ok := h.ensureSession(w, req)
+	if !ok {
+		return
+	}
+
+	action := req.PathValue("action")
+	var statement string
+	switch action {
+	case "commit":
+		statement = "COMMIT"
+	case "rollback":
+		statement = "ROLLBACK"
+	case "savepoint", "rollback_to", "release":
+		var payload struct {
+			Name string `json:"name"`
+		}
+		if err := util.DecodeJsonBody(req).Decode(&payload); err != nil {
+			http.Error(w, "Failed to decode request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if payload.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		name := pq.QuoteIdentifier(payload.Name)
+		statement = map[string]string{
+			"savepoint":   "SAVEPOINT " + name,
+			"rollback_to": "ROLLBACK TO SAVEPOINT " + name,
+			"release":     "RELEASE SAVEPOINT " + name,
+		}[action]
+	default:
+		http.Error(w, "Unknown transaction action "+strconv.Quote(action), http.StatusNotFound)
+		return
+	}
+
+	t, release, err := s.transactions.acquire(req.PathValue("id"))
+	if err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+	defer release()
+
+	ctx, cancel, ok := h.requestContext(w, req, s.connection, h.cfg.QueryTimeout)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	if action == "commit" || action == "rollback" {
+		s.transactions.remove(t.ID)
+		tag, err := t.end(ctx, statement)
+		if err != nil {
+			http.Error(w, "Failed to "+action+" transaction: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		util.WriteJSON(w, http.StatusOK, map[string]any{
+			"id":          t.ID,
+			"command_tag": tag,
+			"committed":   tag == "COMMIT",
+		})
+		return
+	}
+
+	if _, err := t.conn.ExecContext(ctx, statement); err != nil {
+		http.Error(w, "Failed to run "+statement+": "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	util.WriteJSON(w, http.StatusOK, map[string]any{"id": t.ID, "command_tag": strings.Fields(statement)[0]})
+}
+
+func writeTransactionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errTransactionNotFound):
+		http.Error(w, "Transaction not found; it may have been committed, rolled back or reaped", http.StatusNotFound)
+	case errors.Is(err, errTransactionBusy):
+		http.Error(w, "Transaction is busy with another request", http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
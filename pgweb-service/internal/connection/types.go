@@ -45,3 +45,115 @@ func (i *IntValue) UnmarshalJSON(data []byte) error {
 
 // Int converts the value to a builtin int.
 func (i IntValue) Int() int { return int(i) }
+
+// BoolValue accepts JSON booleans or the strings "true"/"false"/"on"/"off", so HTML checkboxes
+// posted through json-enc decode cleanly.
+type BoolValue bool
+
+// UnmarshalJSON implements json.Unmarshaler to support boolean or string input.
+func (b *BoolValue) UnmarshalJSON(data []byte) error {
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" || trimmed == "null" {
+		*b = false
+		return nil
+	}
+
+	if trimmed[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "", "false", "off", "0":
+			*b = false
+		case "true", "on", "1":
+			*b = true
+		default:
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		return nil
+	}
+
+	var v bool
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*b = BoolValue(v)
+	return nil
+}
+
+// Bool converts the value to a builtin bool.
+func (b BoolValue) Bool() bool { return bool(b) }
+
+// SSLMode is a libpq sslmode. For backwards compatibility it also accepts the legacy boolean
+// form (and the "on" an HTML checkbox submits), mapping true to "require" and false to "disable".
+type SSLMode string
+
+const (
+	SSLModeDisable    SSLMode = "disable"
+	SSLModeAllow      SSLMode = "allow"
+	SSLModePrefer     SSLMode = "prefer"
+	SSLModeRequire    SSLMode = "require"
+	SSLModeVerifyCA   SSLMode = "verify-ca"
+	SSLModeVerifyFull SSLMode = "verify-full"
+)
+
+// UnmarshalJSON implements json.Unmarshaler to support boolean or string input.
+func (m *SSLMode) UnmarshalJSON(data []byte) error {
+	trimmed := strings.TrimSpace(string(data))
+	switch trimmed {
+	case "", "null":
+		*m = ""
+		return nil
+	case "true":
+		*m = SSLModeRequire
+		return nil
+	case "false":
+		*m = SSLModeDisable
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid sslmode %s: %w", trimmed, err)
+	}
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "on", "true":
+		*m = SSLModeRequire
+	case "off", "false":
+		*m = SSLModeDisable
+	default:
+		*m = SSLMode(s)
+	}
+	return nil
+}
+
+// Effective returns the mode to use, treating an unset mode as "disable" like the old boolean default.
+func (m SSLMode) Effective() SSLMode {
+	if m == "" {
+		return SSLModeDisable
+	}
+	return m
+}
+
+// Valid reports whether m is one of the libpq sslmodes (or unset).
+func (m SSLMode) Valid() bool {
+	switch m {
+	case "", SSLModeDisable, SSLModeAllow, SSLModePrefer, SSLModeRequire, SSLModeVerifyCA, SSLModeVerifyFull:
+		return true
+	}
+	return false
+}
+
+// attempts lists the modes to try in order. lib/pq only understands disable, require and the
+// verify modes, so allow and prefer are emulated by falling back between plaintext and TLS.
+func (m SSLMode) attempts() []SSLMode {
+	switch m.Effective() {
+	case SSLModeAllow:
+		return []SSLMode{SSLModeDisable, SSLModeRequire}
+	case SSLModePrefer:
+		return []SSLMode{SSLModeRequire, SSLModeDisable}
+	default:
+		return []SSLMode{m.Effective()}
+	}
+}
@@ -6,11 +6,12 @@ import "net/http"
 func WithCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS,PUT,DELETE")
+		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS,PUT,PATCH,DELETE")
 		w.Header().Set(
 			"Access-Control-Allow-Headers",
-			"Content-Type, Accept, HX-Request, HX-Trigger, HX-Target, HX-Current-URL",
+			"Content-Type, Accept, HX-Request, HX-Trigger, HX-Target, HX-Current-URL, X-Pgweb-Session",
 		)
+		w.Header().Set("Access-Control-Expose-Headers", "X-Pgweb-Session, X-Pgweb-Query-Id")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
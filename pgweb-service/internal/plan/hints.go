@@ -0,0 +1,246 @@
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"pgweb-service/internal/sqlparse"
+)
+
+// Thresholds for the findings. They are deliberately coarse: hints point at the nodes worth
+// a look, they don't replace reading the plan.
+const (
+	largeTableRows      = 10000 // a sequential scan below this many rows is cheap either way
+	selectiveFraction   = 0.1   // a filter keeping at most this share of rows is selective
+	nestedLoopOuterRows = 10000 // outer rows above which a nested loop repeats its inner side too often
+	misestimateFactor   = 10    // estimates off by at least this factor either way
+	misestimateMinRows  = 100   // ignore misestimates where both sides are tiny
+)
+
+// Finding is one potential problem spotted in a plan.
+type Finding struct {
+	Kind     string `json:"kind"`     // seq_scan, nested_loop, sort_spill, hash_spill, misestimate or missing_index
+	Severity string `json:"severity"` // warning or info
+	NodeID   int    `json:"node_id"`
+	Node     string `json:"node"`
+	Message  string `json:"message"`
+}
+
+// RelationKey names a table.
+type RelationKey struct {
+	Schema string
+	Name   string
+}
+
+// Relation is what the catalog knows about a table in the plan.
+type Relation struct {
+	// Rows is the planner's row estimate for the table (pg_class.reltuples); negative when
+	// the table has never been analyzed.
+	Rows    float64
+	Columns []string
+	// Indexes holds each index's key columns in order; "" stands for an expression.
+	Indexes [][]string
+}
+
+// indexedColumn reports whether some index on the relation starts with column, the
+// precondition for using it to look up rows by that column alone.
+func (r Relation) indexedColumn(column string) bool {
+	for _, idx := range r.Indexes {
+		if len(idx) > 0 && idx[0] == column {
+			return true
+		}
+	}
+	return false
+}
+
+// Relations lists the tables the plan reads, in order of first appearance.
+func (e *Explain) Relations() []RelationKey {
+	seen := make(map[RelationKey]bool)
+	keys := make([]RelationKey, 0)
+	e.Plan.Walk(func(n *Node) {
+		key := RelationKey{Schema: n.Schema, Name: n.Relation}
+		if n.Relation != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	})
+	return keys
+}
+
+// Hints inspects the plan for common problems, using relations for table sizes and indexes.
+// Tables missing from relations are judged on the plan alone.
+func Hints(e *Explain, relations map[RelationKey]Relation) []Finding {
+	findings := make([]Finding, 0)
+	add := func(n *Node, kind, severity, format string, args ...any) {
+		findings = append(findings, Finding{
+			Kind:     kind,
+			Severity: severity,
+			NodeID:   n.ID,
+			Node:     n.label(),
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	e.Plan.Walk(func(n *Node) {
+		rel, known := relations[RelationKey{Schema: n.Schema, Name: n.Relation}]
+
+		switch n.NodeType {
+		case "Seq Scan":
+			filter, _ := n.Details["Filter"].(string)
+			if filter == "" {
+				break
+			}
+			scanned, kept := n.scannedRows(rel, known)
+			if scanned >= largeTableRows && kept/scanned <= selectiveFraction {
+				add(n, "seq_scan", "warning",
+					"Sequential scan reads %s rows to keep %s (%.1f%%) through filter %s",
+					count(scanned), count(kept), 100*kept/scanned, filter)
+			}
+			if known && max(scanned, rel.Rows) >= largeTableRows {
+				for _, column := range filterColumns(filter, rel.Columns) {
+					if !rel.indexedColumn(column) {
+						add(n, "missing_index", "info",
+							"Column %s of %s is filtered on but no index starts with it",
+							column, n.table())
+					}
+				}
+			}
+
+		case "Nested Loop":
+			if len(n.Plans) == 0 {
+				break
+			}
+			outer := n.Plans[0]
+			rows, measured := outer.totalRows()
+			if rows >= nestedLoopOuterRows {
+				what := "is estimated to return"
+				if measured {
+					what = "returned"
+				}
+				add(n, "nested_loop", "warning",
+					"Nested loop runs its inner side once per outer row, and the outer %s %s %s rows; a hash or merge join may be cheaper",
+					outer.label(), what, count(rows))
+			}
+
+		case "Sort", "Incremental Sort":
+			method, _ := n.Details["Sort Method"].(string)
+			space, _ := n.Details["Sort Space Type"].(string)
+			if space == "Disk" || strings.HasPrefix(method, "external") {
+				used, _ := n.Details["Sort Space Used"].(float64)
+				add(n, "sort_spill", "warning",
+					"Sort spilled to disk (%s, %s kB); raising work_mem or sorting fewer rows keeps it in memory",
+					method, count(used))
+			}
+
+		case "Hash":
+			if batches, _ := n.Details["Hash Batches"].(float64); batches > 1 {
+				add(n, "hash_spill", "warning",
+					"Hash table was split into %s batches on disk; raising work_mem keeps it in memory",
+					count(batches))
+			}
+		}
+
+		if n.EstimateRatio != nil && n.ActualRows != nil {
+			ratio := *n.EstimateRatio
+			if max(*n.ActualRows, n.PlanRows) >= misestimateMinRows && (ratio >= misestimateFactor || ratio <= 1.0/misestimateFactor) {
+				direction := "under"
+				if ratio < 1 {
+					direction, ratio = "over", 1/ratio
+				}
+				add(n, "misestimate", "warning",
+					"Planner %sestimated rows by %.0fx (estimated %s, actual %s per loop); stale statistics or correlated conditions are likely, try ANALYZE",
+					direction, ratio, count(n.PlanRows), count(*n.ActualRows))
+			}
+		}
+	})
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity == "warning" && findings[j].Severity != "warning"
+	})
+	return findings
+}
+
+// scannedRows estimates how many rows a filtered scan read and how many it kept: measured
+// when the plan was analyzed, otherwise from the table's statistics.
+func (n *Node) scannedRows(rel Relation, known bool) (scanned, kept float64) {
+	if n.ActualRows != nil && n.Loops != nil {
+		removed, _ := n.Details["Rows Removed by Filter"].(float64)
+		kept = *n.ActualRows * *n.Loops
+		return kept + removed**n.Loops, kept
+	}
+	if known && rel.Rows > 0 {
+		return rel.Rows, n.PlanRows
+	}
+	return 0, 0
+}
+
+// totalRows is the number of rows the node produced over all loops, measured when possible.
+func (n *Node) totalRows() (float64, bool) {
+	if n.ActualRows != nil && n.Loops != nil {
+		return *n.ActualRows * *n.Loops, true
+	}
+	return n.PlanRows, false
+}
+
+func (n *Node) table() string {
+	if n.Schema == "" {
+		return n.Relation
+	}
+	return n.Schema + "." + n.Relation
+}
+
+// label names a node the way EXPLAIN's text format does, e.g. "Seq Scan on public.orders".
+func (n *Node) label() string {
+	switch {
+	case n.Relation != "" && n.Index != "":
+		return n.NodeType + " using " + n.Index + " on " + n.table()
+	case n.Relation != "":
+		return n.NodeType + " on " + n.table()
+	}
+	return n.NodeType
+}
+
+// filterColumns returns the columns of the table referenced in a plan filter expression,
+// such as "((status)::text = 'open'::text)". Function names and type casts are skipped.
+func filterColumns(filter string, columns []string) []string {
+	tokens, err := sqlparse.Tokenize(filter)
+	if err != nil {
+		return nil
+	}
+
+	known := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		known[c] = true
+	}
+
+	seen := make(map[string]bool)
+	found := make([]string, 0)
+	for i, t := range tokens {
+		var name string
+		switch t.Kind {
+		case sqlparse.Word:
+			name = t.Value
+		case sqlparse.QuotedIdent:
+			name = strings.ReplaceAll(t.Value[1:len(t.Value)-1], `""`, `"`)
+		default:
+			continue
+		}
+		if i > 0 && tokens[i-1].Kind == sqlparse.Punct && tokens[i-1].Value == ":" {
+			continue // ::type
+		}
+		if i+1 < len(tokens) && tokens[i+1].Kind == sqlparse.Punct && tokens[i+1].Value == "(" {
+			continue // function call
+		}
+		if known[name] && !seen[name] {
+			seen[name] = true
+			found = append(found, name)
+		}
+	}
+	return found
+}
+
+// count formats a row or page count without a fractional part.
+func count(f float64) string {
+	return fmt.Sprintf("%.0f", f)
+}
@@ -0,0 +1,174 @@
+package plan
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, raw string) *Explain {
+	t.Helper()
+	e, err := Parse([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func kinds(findings []Finding) []string {
+	k := make([]string, len(findings))
+	for i, f := range findings {
+		k[i] = f.Kind
+	}
+	return k
+}
+
+var orders = RelationKey{Schema: "public", Name: "orders"}
+
+func TestHints(t *testing.T) {
+	tests := []struct {
+		name      string
+		plan      string
+		relations map[RelationKey]Relation
+		want      []string
+	}{
+		{
+			name: "selective seq scan measured by ANALYZE",
+			plan: `[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "orders", "Schema": "public", "Plan Rows": 50,
+				"Actual Total Time": 9, "Actual Rows": 50, "Actual Loops": 1,
+				"Filter": "(status = 'open'::text)", "Rows Removed by Filter": 99950}}]`,
+			want: []string{"seq_scan"},
+		},
+		{
+			name: "selective seq scan from statistics, with a missing index",
+			plan: `[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "orders", "Schema": "public", "Plan Rows": 100,
+				"Filter": "((status)::text = 'open'::text)"}}]`,
+			relations: map[RelationKey]Relation{orders: {Rows: 1e6, Columns: []string{"id", "status"}, Indexes: [][]string{{"id"}}}},
+			want:      []string{"seq_scan", "missing_index"},
+		},
+		{
+			name: "indexed filter column",
+			plan: `[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "orders", "Schema": "public", "Plan Rows": 900000,
+				"Filter": "(status <> 'done'::text)"}}]`,
+			relations: map[RelationKey]Relation{orders: {Rows: 1e6, Columns: []string{"status"}, Indexes: [][]string{{"status", "id"}}}},
+			want:      []string{},
+		},
+		{
+			name: "small table",
+			plan: `[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "orders", "Schema": "public", "Plan Rows": 1,
+				"Filter": "(id = 1)"}}]`,
+			relations: map[RelationKey]Relation{orders: {Rows: 500, Columns: []string{"id"}}},
+			want:      []string{},
+		},
+		{
+			name:      "seq scan without a filter",
+			plan:      `[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "orders", "Schema": "public", "Plan Rows": 1000000}}]`,
+			relations: map[RelationKey]Relation{orders: {Rows: 1e6, Columns: []string{"id"}}},
+			want:      []string{},
+		},
+		{
+			name: "nested loop over a large outer side",
+			plan: `[{"Plan": {"Node Type": "Nested Loop", "Plan Rows": 50000, "Plans": [
+				{"Node Type": "Seq Scan", "Relation Name": "orders", "Plan Rows": 50000},
+				{"Node Type": "Index Scan", "Relation Name": "customers", "Plan Rows": 1}
+			]}}]`,
+			want: []string{"nested_loop"},
+		},
+		{
+			name: "nested loop over a small outer side",
+			plan: `[{"Plan": {"Node Type": "Nested Loop", "Plan Rows": 5, "Plans": [
+				{"Node Type": "Seq Scan", "Relation Name": "orders", "Plan Rows": 5},
+				{"Node Type": "Index Scan", "Relation Name": "customers", "Plan Rows": 1}
+			]}}]`,
+			want: []string{},
+		},
+		{
+			name: "sort and hash spills",
+			plan: `[{"Plan": {"Node Type": "Sort", "Sort Method": "external merge", "Sort Space Used": 20480, "Sort Space Type": "Disk", "Plans": [
+				{"Node Type": "Hash", "Hash Batches": 4},
+				{"Node Type": "Sort", "Sort Method": "quicksort", "Sort Space Type": "Memory"}
+			]}}]`,
+			want: []string{"sort_spill", "hash_spill"},
+		},
+		{
+			name: "misestimate",
+			plan: `[{"Plan": {"Node Type": "Index Scan", "Relation Name": "orders", "Plan Rows": 10,
+				"Actual Total Time": 1, "Actual Rows": 5000, "Actual Loops": 1}}]`,
+			want: []string{"misestimate"},
+		},
+		{
+			name: "tiny misestimate is ignored",
+			plan: `[{"Plan": {"Node Type": "Index Scan", "Relation Name": "orders", "Plan Rows": 1,
+				"Actual Total Time": 1, "Actual Rows": 50, "Actual Loops": 1}}]`,
+			want: []string{},
+		},
+		{
+			name: "warnings before info",
+			plan: `[{"Plan": {"Node Type": "Hash Join", "Plans": [
+				{"Node Type": "Seq Scan", "Relation Name": "orders", "Schema": "public", "Plan Rows": 900000, "Filter": "(status = 'x'::text)"},
+				{"Node Type": "Hash", "Hash Batches": 2}
+			]}}]`,
+			relations: map[RelationKey]Relation{orders: {Rows: 1e6, Columns: []string{"status"}}},
+			want:      []string{"hash_spill", "missing_index"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := kinds(Hints(mustParse(t, tt.plan), tt.relations))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Hints = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHintMessages(t *testing.T) {
+	e := mustParse(t, `[{"Plan": {"Node Type": "Index Scan", "Relation Name": "orders", "Schema": "public", "Index Name": "orders_pkey",
+		"Plan Rows": 5000, "Actual Total Time": 1, "Actual Rows": 20, "Actual Loops": 1}}]`)
+	findings := Hints(e, nil)
+	if len(findings) != 1 {
+		t.Fatalf("Hints = %+v, want one finding", findings)
+	}
+	f := findings[0]
+	if f.NodeID != 1 || f.Node != "Index Scan using orders_pkey on public.orders" || f.Severity != "warning" {
+		t.Errorf("finding = %+v", f)
+	}
+	if !strings.Contains(f.Message, "overestimated rows by 250x (estimated 5000, actual 20") {
+		t.Errorf("message = %q", f.Message)
+	}
+}
+
+func TestRelations(t *testing.T) {
+	e := mustParse(t, `[{"Plan": {"Node Type": "Hash Join", "Plans": [
+		{"Node Type": "Seq Scan", "Relation Name": "orders", "Schema": "public"},
+		{"Node Type": "Hash", "Plans": [
+			{"Node Type": "Seq Scan", "Relation Name": "customers", "Schema": "public"},
+			{"Node Type": "Seq Scan", "Relation Name": "orders", "Schema": "public"}
+		]}
+	]}}]`)
+	want := []RelationKey{orders, {Schema: "public", Name: "customers"}}
+	if got := e.Relations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Relations = %v, want %v", got, want)
+	}
+}
+
+func TestFilterColumns(t *testing.T) {
+	columns := []string{"id", "status", "created_at", "Mixed Case", "lower"}
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{"((status)::text = 'open'::text)", []string{"status"}},
+		{"((id > 10) AND (created_at < now()) AND (id < 20))", []string{"id", "created_at"}},
+		{`("Mixed Case" IS NOT NULL)`, []string{"Mixed Case"}},
+		// lower( is a function call and ::status a type, not the columns of the same name.
+		{"(lower(name) = 'x'::status)", []string{}},
+		{"('status' = id::text)", []string{"id"}},
+		{"(unterminated = 'x", nil},
+	}
+	for _, tt := range tests {
+		if got := filterColumns(tt.filter, columns); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("filterColumns(%q) = %q, want %q", tt.filter, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Package plan parses the output of EXPLAIN (FORMAT JSON) into a tree with the figures needed
+// to read it: costs, actual timings per node and how far the row estimates were off.
+package plan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Explain is one EXPLAIN result.
+type Explain struct {
+	Plan *Node `json:"plan"`
+	// PlanningMS and ExecutionMS are only reported by EXPLAIN ANALYZE (and SUMMARY).
+	PlanningMS  *float64         `json:"planning_time_ms,omitempty"`
+	ExecutionMS *float64         `json:"execution_time_ms,omitempty"`
+	Triggers    []map[string]any `json:"triggers,omitempty"`
+	Settings    map[string]any   `json:"settings,omitempty"`
+	// Analyzed reports whether the plan carries actual timings and row counts.
+	Analyzed bool `json:"analyzed"`
+}
+
+// Node is one plan node. Fields PostgreSQL reports that have no dedicated field here, such as
+// "Filter", "Join Type" or buffer counters, are kept verbatim in Details.
+type Node struct {
+	// ID numbers the nodes of a plan depth-first from 1, so findings can point at them.
+	ID       int    `json:"id"`
+	NodeType string `json:"node_type"`
+	Relation string `json:"relation,omitempty"`
+	Schema   string `json:"schema,omitempty"`
+	Alias    string `json:"alias,omitempty"`
+	Index    string `json:"index,omitempty"`
+
+	StartupCost float64 `json:"startup_cost"`
+	TotalCost   float64 `json:"total_cost"`
+	PlanRows    float64 `json:"plan_rows"`
+	PlanWidth   float64 `json:"plan_width"`
+
+	// Actual figures, present with ANALYZE. Times are per loop, in milliseconds, as
+	// PostgreSQL reports them; ActualRows is per loop too.
+	ActualStartupMS *float64 `json:"actual_startup_time_ms,omitempty"`
+	ActualTotalMS   *float64 `json:"actual_total_time_ms,omitempty"`
+	ActualRows      *float64 `json:"actual_rows,omitempty"`
+	Loops           *float64 `json:"actual_loops,omitempty"`
+
+	// TotalMS is the node's time over all loops and SelfMS that time minus its children's.
+	TotalMS *float64 `json:"total_time_ms,omitempty"`
+	SelfMS  *float64 `json:"self_time_ms,omitempty"`
+	// EstimateRatio is actual rows over estimated rows, both counted as at least one: above
+	// 1 the planner underestimated, below 1 it overestimated.
+	EstimateRatio *float64 `json:"estimate_ratio,omitempty"`
+
+	Details map[string]any `json:"details,omitempty"`
+	Plans   []*Node        `json:"plans,omitempty"`
+}
+
+// Walk calls fn for n and every node below it, parents first.
+func (n *Node) Walk(fn func(*Node)) {
+	fn(n)
+	for _, child := range n.Plans {
+		child.Walk(fn)
+	}
+}
+
+// Parse reads the single-row output of EXPLAIN (FORMAT JSON).
+func Parse(raw []byte) (*Explain, error) {
+	var results []map[string]any
+	if err := json.Unmarshal(raw, &results); err != nil {
+		return nil, fmt.Errorf("malformed EXPLAIN output: %w", err)
+	}
+	if len(results) != 1 {
+		return nil, fmt.Errorf("expected one EXPLAIN result, got %d", len(results))
+	}
+	result := results[0]
+
+	root, ok := result["Plan"].(map[string]any)
+	if !ok {
+		return nil, errors.New("EXPLAIN output has no plan")
+	}
+
+	e := &Explain{
+		Plan:        parseNode(root),
+		PlanningMS:  number(result, "Planning Time"),
+		ExecutionMS: number(result, "Execution Time"),
+	}
+	e.Analyzed = e.Plan.ActualTotalMS != nil
+	id := 0
+	e.Plan.Walk(func(n *Node) {
+		id++
+		n.ID = id
+	})
+	if triggers, ok := result["Triggers"].([]any); ok {
+		for _, t := range triggers {
+			if m, ok := t.(map[string]any); ok {
+				e.Triggers = append(e.Triggers, m)
+			}
+		}
+	}
+	if settings, ok := result["Settings"].(map[string]any); ok {
+		e.Settings = settings
+	}
+	return e, nil
+}
+
+func parseNode(m map[string]any) *Node {
+	n := &Node{
+		NodeType: text(m, "Node Type"),
+		Relation: text(m, "Relation Name"),
+		Schema:   text(m, "Schema"),
+		Alias:    text(m, "Alias"),
+		Index:    text(m, "Index Name"),
+
+		ActualStartupMS: number(m, "Actual Startup Time"),
+		ActualTotalMS:   number(m, "Actual Total Time"),
+		ActualRows:      number(m, "Actual Rows"),
+		Loops:           number(m, "Actual Loops"),
+	}
+	if v := number(m, "Startup Cost"); v != nil {
+		n.StartupCost = *v
+	}
+	if v := number(m, "Total Cost"); v != nil {
+		n.TotalCost = *v
+	}
+	if v := number(m, "Plan Rows"); v != nil {
+		n.PlanRows = *v
+	}
+	if v := number(m, "Plan Width"); v != nil {
+		n.PlanWidth = *v
+	}
+
+	if children, ok := m["Plans"].([]any); ok {
+		for _, c := range children {
+			if child, ok := c.(map[string]any); ok {
+				n.Plans = append(n.Plans, parseNode(child))
+			}
+		}
+	}
+
+	for key, v := range m {
+		if structured[key] {
+			continue
+		}
+		if n.Details == nil {
+			n.Details = make(map[string]any)
+		}
+		n.Details[key] = v
+	}
+
+	n.derive()
+	return n
+}
+
+// derive fills in the figures computed from the actual timings. Nodes that never ran
+// ("never executed") report zero loops and get none.
+func (n *Node) derive() {
+	if n.ActualTotalMS == nil || n.Loops == nil || *n.Loops == 0 {
+		return
+	}
+
+	total := *n.ActualTotalMS * *n.Loops
+	self := total
+	for _, child := range n.Plans {
+		if child.TotalMS != nil {
+			self -= *child.TotalMS
+		}
+	}
+	n.TotalMS = ptr(roundMS(total))
+	n.SelfMS = ptr(roundMS(max(self, 0)))
+
+	if n.ActualRows != nil {
+		n.EstimateRatio = ptr(max(*n.ActualRows, 1) / max(n.PlanRows, 1))
+	}
+}
+
+// structured lists the keys that have a dedicated Node field.
+var structured = map[string]bool{
+	"Node Type": true, "Relation Name": true, "Schema": true, "Alias": true, "Index Name": true,
+	"Startup Cost": true, "Total Cost": true, "Plan Rows": true, "Plan Width": true,
+	"Actual Startup Time": true, "Actual Total Time": true, "Actual Rows": true, "Actual Loops": true,
+	"Plans": true,
+}
+
+func text(m map[string]any, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func number(m map[string]any, key string) *float64 {
+	f, ok := m[key].(float64)
+	if !ok {
+		return nil
+	}
+	return &f
+}
+
+func ptr(f float64) *float64 { return &f }
+
+// roundMS rounds to the microsecond precision PostgreSQL reports timings in, hiding the float
+// noise of the subtraction in derive.
+func roundMS(ms float64) float64 { return math.Round(ms*1000) / 1000 }
@@ -0,0 +1,151 @@
+package plan
+
+import (
+	"math"
+	"testing"
+)
+
+const analyzedPlan = `[{
+	"Plan": {
+		"Node Type": "Hash Join", "Join Type": "Inner",
+		"Startup Cost": 1.5, "Total Cost": 40.25, "Plan Rows": 10, "Plan Width": 16,
+		"Actual Startup Time": 0.1, "Actual Total Time": 5.5, "Actual Rows": 1000, "Actual Loops": 1,
+		"Plans": [
+			{
+				"Node Type": "Seq Scan", "Relation Name": "orders", "Schema": "public", "Alias": "o",
+				"Startup Cost": 0, "Total Cost": 20, "Plan Rows": 500, "Plan Width": 8,
+				"Actual Startup Time": 0.01, "Actual Total Time": 2.1, "Actual Rows": 500, "Actual Loops": 1,
+				"Filter": "(status = 'open'::text)", "Shared Hit Blocks": 12
+			},
+			{
+				"Node Type": "Hash",
+				"Startup Cost": 1, "Total Cost": 1, "Plan Rows": 1, "Plan Width": 8,
+				"Actual Startup Time": 0.3, "Actual Total Time": 0.3, "Actual Rows": 0, "Actual Loops": 2,
+				"Plans": [
+					{
+						"Node Type": "Index Scan", "Relation Name": "customers", "Schema": "public", "Index Name": "customers_pkey",
+						"Startup Cost": 0, "Total Cost": 1, "Plan Rows": 1, "Plan Width": 8,
+						"Actual Startup Time": 0, "Actual Total Time": 0, "Actual Rows": 0, "Actual Loops": 0
+					}
+				]
+			}
+		]
+	},
+	"Planning Time": 0.25,
+	"Triggers": [{"Trigger Name": "audit", "Calls": 3}],
+	"Execution Time": 6.125
+}]`
+
+func TestParseAnalyzed(t *testing.T) {
+	e, err := Parse([]byte(analyzedPlan))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Analyzed {
+		t.Error("plan with actual timings not reported as analyzed")
+	}
+	if e.PlanningMS == nil || *e.PlanningMS != 0.25 || e.ExecutionMS == nil || *e.ExecutionMS != 6.125 {
+		t.Errorf("planning/execution = %v/%v", e.PlanningMS, e.ExecutionMS)
+	}
+	if len(e.Triggers) != 1 || e.Triggers[0]["Trigger Name"] != "audit" {
+		t.Errorf("triggers = %v", e.Triggers)
+	}
+
+	// IDs are depth-first, parents first.
+	var ids []int
+	var types []string
+	e.Plan.Walk(func(n *Node) {
+		ids = append(ids, n.ID)
+		types = append(types, n.NodeType)
+	})
+	wantTypes := []string{"Hash Join", "Seq Scan", "Hash", "Index Scan"}
+	for i := range wantTypes {
+		if i >= len(ids) || ids[i] != i+1 || types[i] != wantTypes[i] {
+			t.Fatalf("walk order = %v %v, want %v numbered from 1", ids, types, wantTypes)
+		}
+	}
+
+	scan := e.Plan.Plans[0]
+	if scan.Relation != "orders" || scan.Schema != "public" || scan.Alias != "o" || scan.TotalCost != 20 || scan.PlanRows != 500 {
+		t.Errorf("seq scan = %+v", scan)
+	}
+	if scan.Details["Filter"] != "(status = 'open'::text)" || scan.Details["Shared Hit Blocks"] != 12.0 {
+		t.Errorf("seq scan details = %v", scan.Details)
+	}
+	if _, ok := scan.Details["Node Type"]; ok {
+		t.Error("structured key copied into details")
+	}
+	if e.Plan.Details["Join Type"] != "Inner" {
+		t.Errorf("join details = %v", e.Plan.Details)
+	}
+	if index := e.Plan.Plans[1].Plans[0]; index.Index != "customers_pkey" {
+		t.Errorf("index scan = %+v", index)
+	}
+}
+
+func TestDerive(t *testing.T) {
+	e, err := Parse([]byte(analyzedPlan))
+	if err != nil {
+		t.Fatal(err)
+	}
+	join, scan, hash, index := e.Plan, e.Plan.Plans[0], e.Plan.Plans[1], e.Plan.Plans[1].Plans[0]
+
+	tests := []struct {
+		name string
+		got  *float64
+		want float64
+	}{
+		{"join total", join.TotalMS, 5.5},
+		// 5.5 minus the scan's 2.1 and the hash's 0.3 ms per loop over two loops.
+		{"join self", join.SelfMS, 2.8},
+		{"scan self", scan.SelfMS, 2.1},
+		{"hash total over loops", hash.TotalMS, 0.6},
+		{"underestimate", join.EstimateRatio, 100},
+		{"exact estimate", scan.EstimateRatio, 1},
+		// Zero rows count as one, so an empty result doesn't divide by zero.
+		{"no rows", hash.EstimateRatio, 1},
+	}
+	for _, tt := range tests {
+		if tt.got == nil {
+			t.Errorf("%s: not derived", tt.name)
+			continue
+		}
+		if math.Abs(*tt.got-tt.want) > 1e-9 {
+			t.Errorf("%s = %v, want %v", tt.name, *tt.got, tt.want)
+		}
+	}
+
+	if index.TotalMS != nil || index.SelfMS != nil || index.EstimateRatio != nil {
+		t.Error("a node that never executed got derived figures")
+	}
+}
+
+func TestParseWithoutAnalyze(t *testing.T) {
+	e, err := Parse([]byte(`[{"Plan": {"Node Type": "Result", "Startup Cost": 0, "Total Cost": 0.01, "Plan Rows": 1, "Plan Width": 4}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Analyzed || e.PlanningMS != nil || e.ExecutionMS != nil {
+		t.Errorf("plain EXPLAIN reported as analyzed: %+v", e)
+	}
+	if e.Plan.ID != 1 || e.Plan.TotalCost != 0.01 || e.Plan.TotalMS != nil || e.Plan.Details != nil {
+		t.Errorf("plan = %+v", e.Plan)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"not JSON":       "QUERY PLAN",
+		"no results":     "[]",
+		"two results":    `[{"Plan": {}}, {"Plan": {}}]`,
+		"no plan":        `[{"Planning Time": 1}]`,
+		"plan not a map": `[{"Plan": "Seq Scan"}]`,
+	}
+	for name, raw := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(raw)); err == nil {
+				t.Errorf("Parse(%s) succeeded, want an error", raw)
+			}
+		})
+	}
+}
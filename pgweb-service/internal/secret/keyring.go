@@ -0,0 +1,180 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// ciphertextPrefix marks values produced by Encrypt; the key ID follows it.
+	ciphertextPrefix = "enc:v1:"
+	keySize          = 32
+)
+
+// ErrNoKey is returned when a secret must be encrypted or decrypted but no keyring is configured.
+var ErrNoKey = errors.New("no encryption key configured; set PGWEB_SECRET_KEY or PGWEB_SECRET_KEY_FILE")
+
+type key struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// Keyring encrypts secrets with AES-256-GCM under its primary key and decrypts with any key it holds,
+// which lets old keys stay readable while entries are rotated onto a new one.
+type Keyring struct {
+	primary *key
+	keys    map[string]*key
+}
+
+// NewKeyring builds a keyring from raw 32-byte keys; the first key is the primary.
+func NewKeyring(rawKeys ...[]byte) (*Keyring, error) {
+	if len(rawKeys) == 0 {
+		return nil, errors.New("at least one key is required")
+	}
+
+	k := &Keyring{keys: make(map[string]*key, len(rawKeys))}
+	for i, raw := range rawKeys {
+		if len(raw) != keySize {
+			return nil, fmt.Errorf("key %d must be %d bytes, got %d", i+1, keySize, len(raw))
+		}
+
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(raw)
+		entry := &key{id: hex.EncodeToString(sum[:4]), aead: aead}
+		if i == 0 {
+			k.primary = entry
+		}
+		k.keys[entry.id] = entry
+	}
+
+	return k, nil
+}
+
+// LoadKeyring reads keys from the environment. PGWEB_SECRET_KEY holds the base64 primary key and
+// PGWEB_SECRET_PREVIOUS_KEYS a comma-separated list of older ones; alternatively PGWEB_SECRET_KEY_FILE
+// names a file with one base64 key per line, primary first. It returns nil when neither is set.
+func LoadKeyring() (*Keyring, error) {
+	envKey := os.Getenv("PGWEB_SECRET_KEY")
+	keyFile := os.Getenv("PGWEB_SECRET_KEY_FILE")
+
+	var encoded []string
+	switch {
+	case envKey != "" && keyFile != "":
+		return nil, errors.New("set only one of PGWEB_SECRET_KEY and PGWEB_SECRET_KEY_FILE")
+	case envKey != "":
+		encoded = append(encoded, envKey)
+		if previous := os.Getenv("PGWEB_SECRET_PREVIOUS_KEYS"); previous != "" {
+			encoded = append(encoded, strings.Split(previous, ",")...)
+		}
+	case keyFile != "":
+		raw, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		for _, line := range strings.Split(string(raw), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			encoded = append(encoded, line)
+		}
+		if len(encoded) == 0 {
+			return nil, fmt.Errorf("key file %s contains no keys", keyFile)
+		}
+	default:
+		return nil, nil
+	}
+
+	rawKeys := make([][]byte, 0, len(encoded))
+	for i, e := range encoded {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(e))
+		if err != nil {
+			return nil, fmt.Errorf("key %d is not valid base64: %w", i+1, err)
+		}
+		rawKeys = append(rawKeys, raw)
+	}
+
+	return NewKeyring(rawKeys...)
+}
+
+// GenerateKey returns a new random key encoded for PGWEB_SECRET_KEY or a key file.
+func GenerateKey() (string, error) {
+	raw := make([]byte, keySize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// IsEncrypted reports whether value looks like the output of Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, ciphertextPrefix)
+}
+
+// Encrypt seals plaintext under the primary key as "enc:v1:<key id>:<base64 nonce+ciphertext>".
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if k == nil {
+		return "", ErrNoKey
+	}
+
+	nonce := make([]byte, k.primary.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := k.primary.aead.Seal(nonce, nonce, []byte(plaintext), []byte(k.primary.id))
+	return ciphertextPrefix + k.primary.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt with whichever held key sealed it.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if k == nil {
+		return "", ErrNoKey
+	}
+
+	id, payload, ok := strings.Cut(strings.TrimPrefix(value, ciphertextPrefix), ":")
+	if !ok || !IsEncrypted(value) {
+		return "", errors.New("value is not an encrypted secret")
+	}
+
+	entry, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("secret was encrypted with unknown key %s", id)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted secret: %w", err)
+	}
+	if len(sealed) < entry.aead.NonceSize() {
+		return "", errors.New("malformed encrypted secret: too short")
+	}
+
+	nonce, ciphertext := sealed[:entry.aead.NonceSize()], sealed[entry.aead.NonceSize():]
+	plaintext, err := entry.aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret with key %s: %w", id, err)
+	}
+	return string(plaintext), nil
+}
+
+// IsCurrent reports whether value is already encrypted under the primary key.
+func (k *Keyring) IsCurrent(value string) bool {
+	return k != nil && strings.HasPrefix(value, ciphertextPrefix+k.primary.id+":")
+}
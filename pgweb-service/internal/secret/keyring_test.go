@@ -0,0 +1,223 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func rawKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, keySize)
+}
+
+func mustKeyring(t *testing.T, keys ...[]byte) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	k := mustKeyring(t, rawKey(1))
+	for _, plaintext := range []string{"", "hunter2", "päss wörd ✓", strings.Repeat("x", 4096)} {
+		sealed, err := k.Encrypt(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(sealed) || !k.IsCurrent(sealed) {
+			t.Errorf("Encrypt(%q) = %q, not marked as current ciphertext", plaintext, sealed)
+		}
+		if plaintext != "" && strings.Contains(sealed, plaintext) {
+			t.Errorf("ciphertext %q contains the plaintext", sealed)
+		}
+		got, err := k.Decrypt(sealed)
+		if err != nil {
+			t.Fatalf("Decrypt(%q): %v", sealed, err)
+		}
+		if got != plaintext {
+			t.Errorf("round trip = %q, want %q", got, plaintext)
+		}
+	}
+}
+
+func TestEncryptUsesFreshNonces(t *testing.T) {
+	k := mustKeyring(t, rawKey(1))
+	a, _ := k.Encrypt("same")
+	b, _ := k.Encrypt("same")
+	if a == b {
+		t.Error("encrypting the same plaintext twice gave identical ciphertexts")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old := mustKeyring(t, rawKey(1))
+	sealed, err := old.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new primary comes first; the old key stays readable.
+	rotated := mustKeyring(t, rawKey(2), rawKey(1))
+	if rotated.IsCurrent(sealed) {
+		t.Error("value sealed under the old key reported as current")
+	}
+	got, err := rotated.Decrypt(sealed)
+	if err != nil || got != "secret" {
+		t.Fatalf("Decrypt with previous key = %q, %v", got, err)
+	}
+
+	resealed, err := rotated.Encrypt(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rotated.IsCurrent(resealed) {
+		t.Error("re-encrypted value not under the new primary key")
+	}
+
+	newOnly := mustKeyring(t, rawKey(2))
+	if got, err := newOnly.Decrypt(resealed); err != nil || got != "secret" {
+		t.Errorf("Decrypt after dropping the old key = %q, %v", got, err)
+	}
+	if _, err := newOnly.Decrypt(sealed); err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Errorf("Decrypt of a value under a dropped key: error = %v, want unknown key", err)
+	}
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	k := mustKeyring(t, rawKey(1), rawKey(2))
+	sealed, err := k.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, payload, _ := strings.Cut(strings.TrimPrefix(sealed, ciphertextPrefix), ":")
+	raw, _ := base64.StdEncoding.DecodeString(payload)
+
+	flipped := append([]byte(nil), raw...)
+	flipped[len(flipped)-1] ^= 1
+
+	other := mustKeyring(t, rawKey(2))
+	otherID := other.primary.id
+
+	tests := map[string]string{
+		"flipped ciphertext bit": ciphertextPrefix + id + ":" + base64.StdEncoding.EncodeToString(flipped),
+		// The key ID is authenticated, so relabelling a value can't make another key open it.
+		"relabelled key id": ciphertextPrefix + otherID + ":" + payload,
+		"truncated":         ciphertextPrefix + id + ":" + base64.StdEncoding.EncodeToString(raw[:4]),
+		"not base64":        ciphertextPrefix + id + ":!!!",
+		"missing payload":   ciphertextPrefix + id,
+		"plaintext":         "secret",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got, err := k.Decrypt(value); err == nil {
+				t.Errorf("Decrypt(%q) = %q, want an error", value, got)
+			}
+		})
+	}
+}
+
+func TestNilKeyring(t *testing.T) {
+	var k *Keyring
+	if _, err := k.Encrypt("x"); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Encrypt on nil keyring: %v, want ErrNoKey", err)
+	}
+	if _, err := k.Decrypt(ciphertextPrefix + "00000000:AAAA"); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Decrypt on nil keyring: %v, want ErrNoKey", err)
+	}
+	if k.IsCurrent(ciphertextPrefix + "00000000:AAAA") {
+		t.Error("nil keyring reports a value as current")
+	}
+}
+
+func TestNewKeyringValidatesKeys(t *testing.T) {
+	if _, err := NewKeyring(); err == nil {
+		t.Error("NewKeyring with no keys succeeded")
+	}
+	if _, err := NewKeyring(rawKey(1), make([]byte, 16)); err == nil {
+		t.Error("NewKeyring accepted a 16-byte key")
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	encode := func(b byte) string { return base64.StdEncoding.EncodeToString(rawKey(b)) }
+
+	t.Run("unset", func(t *testing.T) {
+		t.Setenv("PGWEB_SECRET_KEY", "")
+		t.Setenv("PGWEB_SECRET_KEY_FILE", "")
+		k, err := LoadKeyring()
+		if err != nil || k != nil {
+			t.Errorf("LoadKeyring() = %v, %v; want nil, nil", k, err)
+		}
+	})
+
+	t.Run("environment with previous keys", func(t *testing.T) {
+		sealed, _ := mustKeyring(t, rawKey(3)).Encrypt("old")
+		t.Setenv("PGWEB_SECRET_KEY", encode(1))
+		t.Setenv("PGWEB_SECRET_PREVIOUS_KEYS", encode(2)+", "+encode(3))
+		t.Setenv("PGWEB_SECRET_KEY_FILE", "")
+		k, err := LoadKeyring()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := k.Decrypt(sealed); err != nil || got != "old" {
+			t.Errorf("Decrypt with a previous key = %q, %v", got, err)
+		}
+		current, _ := k.Encrypt("new")
+		if !mustKeyring(t, rawKey(1)).IsCurrent(current) {
+			t.Error("PGWEB_SECRET_KEY is not the primary key")
+		}
+	})
+
+	t.Run("key file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "keys")
+		content := "# rotated 2026-10\n" + encode(4) + "\n\n" + encode(5) + "\n"
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("PGWEB_SECRET_KEY", "")
+		t.Setenv("PGWEB_SECRET_KEY_FILE", path)
+		k, err := LoadKeyring()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(k.keys) != 2 || k.primary.id != mustKeyring(t, rawKey(4)).primary.id {
+			t.Errorf("key file loaded %d keys with primary %s", len(k.keys), k.primary.id)
+		}
+	})
+
+	t.Run("both set", func(t *testing.T) {
+		t.Setenv("PGWEB_SECRET_KEY", encode(1))
+		t.Setenv("PGWEB_SECRET_KEY_FILE", "/nonexistent")
+		if _, err := LoadKeyring(); err == nil {
+			t.Error("LoadKeyring accepted both PGWEB_SECRET_KEY and PGWEB_SECRET_KEY_FILE")
+		}
+	})
+
+	t.Run("invalid base64", func(t *testing.T) {
+		t.Setenv("PGWEB_SECRET_KEY", "not base64!")
+		t.Setenv("PGWEB_SECRET_KEY_FILE", "")
+		if _, err := LoadKeyring(); err == nil {
+			t.Error("LoadKeyring accepted an invalid key")
+		}
+	})
+}
+
+func TestGenerateKey(t *testing.T) {
+	encoded, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != keySize {
+		t.Fatalf("GenerateKey() = %q: %d bytes, %v", encoded, len(raw), err)
+	}
+	if _, err := NewKeyring(raw); err != nil {
+		t.Errorf("generated key rejected: %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package sqlparse
+
+import "strings"
+
+// IsReadOnly reports whether every statement in sql only reads data. It is deliberately
+// conservative: anything it does not recognise as a plain read is treated as a write.
+func IsReadOnly(sql string) (bool, error) {
+	statements, err := Split(sql)
+	if err != nil {
+		return false, err
+	}
+
+	for _, stmt := range statements {
+		if !readOnlyTokens(stmt.Tokens) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func readOnlyTokens(tokens []Token) bool {
+	// "(SELECT ...)" is a valid statement; the parentheses do not change what it does.
+	for len(tokens) > 0 && tokens[0].Kind == Punct && tokens[0].Value == "(" {
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 || tokens[0].Kind != Word {
+		return false
+	}
+
+	switch tokens[0].Value {
+	case "show", "table":
+		return true
+	case "values":
+		return !callsSetConfig(tokens)
+	case "select":
+		// SELECT ... INTO creates a table.
+		return !hasTopLevelWord(tokens, "into") && !callsSetConfig(tokens)
+	case "with":
+		// Data-modifying CTEs may appear anywhere in the statement.
+		return !hasWord(tokens, "insert", "update", "delete", "merge") && !hasTopLevelWord(tokens, "into") &&
+			!callsSetConfig(tokens)
+	case "explain":
+		inner, analyze := explainTarget(tokens[1:])
+		// Plain EXPLAIN only plans the statement; EXPLAIN ANALYZE executes it.
+		return !analyze || readOnlyTokens(inner)
+	}
+	return false
+}
+
+// explainTarget skips EXPLAIN's options and reports whether ANALYZE was among them.
+func explainTarget(tokens []Token) ([]Token, bool) {
+	analyze := false
+	if len(tokens) > 0 && tokens[0].Kind == Punct && tokens[0].Value == "(" {
+		depth := 0
+		for i, t := range tokens {
+			if t.Kind == Word && (t.Value == "analyze" || t.Value == "analyse") {
+				// "ANALYZE false" / "ANALYZE off" disables it again.
+				analyze = i+1 >= len(tokens) || !isFalse(tokens[i+1])
+			}
+			if t.Kind == Punct && t.Value == "(" {
+				depth++
+			}
+			if t.Kind == Punct && t.Value == ")" {
+				depth--
+				if depth == 0 {
+					return tokens[i+1:], analyze
+				}
+			}
+		}
+		return nil, analyze
+	}
+
+	for len(tokens) > 0 && tokens[0].Kind == Word {
+		switch tokens[0].Value {
+		case "analyze", "analyse":
+			analyze = true
+		case "verbose":
+		default:
+			return tokens, analyze
+		}
+		tokens = tokens[1:]
+	}
+	return tokens, analyze
+}
+
+// callsSetConfig reports whether the statement mentions set_config, the function form of SET:
+// set_config('default_transaction_read_only', 'off', false) would switch a read-only
+// session to read-write, so any call is treated as a write.
+func callsSetConfig(tokens []Token) bool {
+	for _, t := range tokens {
+		if (t.Kind == Word && t.Value == "set_config") || (t.Kind == QuotedIdent && t.Value == `"set_config"`) {
+			return true
+		}
+	}
+	return false
+}
+
+func isFalse(t Token) bool {
+	if t.Kind == Word {
+		return t.Value == "false" || t.Value == "off"
+	}
+	return t.Kind == Number && t.Value == "0"
+}
+
+func hasWord(tokens []Token, words ...string) bool {
+	for _, t := range tokens {
+		if t.Kind != Word {
+			continue
+		}
+		for _, w := range words {
+			if t.Value == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasTopLevelWord reports whether word appears outside any parentheses.
+func hasTopLevelWord(tokens []Token, word string) bool {
+	depth := 0
+	for _, t := range tokens {
+		switch {
+		case t.Kind == Punct && t.Value == "(":
+			depth++
+		case t.Kind == Punct && t.Value == ")":
+			depth--
+		case depth == 0 && t.Kind == Word && t.Value == word:
+			return true
+		}
+	}
+	return false
+}
+
+// Classification describes what a statement does, so that callers can warn before running
+// statements that are hard to undo.
+type Classification struct {
+	Statement string `json:"statement"`
+	// Command is the statement's leading keyword, e.g. "DELETE" or "DROP".
+	Command  string `json:"command"`
+	ReadOnly bool   `json:"read_only"`
+	// Destructive marks statements that drop, truncate or alter objects, and updates or
+	// deletes without a WHERE clause; Reason says why.
+	Destructive bool   `json:"destructive"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// Classify classifies every statement in sql.
+func Classify(sql string) ([]Classification, error) {
+	statements, err := Split(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Classification, 0, len(statements))
+	for _, stmt := range statements {
+		c := Classification{
+			Statement: stmt.Text,
+			ReadOnly:  readOnlyTokens(stmt.Tokens),
+			Reason:    destructiveReason(stmt.Tokens),
+		}
+		c.Destructive = c.Reason != ""
+		if first := leadingWord(stmt.Tokens); first != "" {
+			c.Command = strings.ToUpper(first)
+		}
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+// leadingWord returns the statement's first keyword, skipping opening parentheses.
+func leadingWord(tokens []Token) string {
+	for _, t := range tokens {
+		if t.Kind == Punct && t.Value == "(" {
+			continue
+		}
+		if t.Kind == Word {
+			return t.Value
+		}
+		break
+	}
+	return ""
+}
+
+// destructiveReason explains why a statement is destructive, or returns "" if it isn't.
+func destructiveReason(tokens []Token) string {
+	switch leadingWord(tokens) {
+	case "drop":
+		return "DROP removes the object and everything stored in it"
+	case "truncate":
+		return "TRUNCATE removes every row"
+	case "alter":
+		return "ALTER changes the schema and may rewrite or discard data"
+	case "explain":
+		// Plain EXPLAIN only plans the statement; EXPLAIN ANALYZE executes it.
+		inner, analyze := explainTarget(tokens[1:])
+		if analyze {
+			return destructiveReason(inner)
+		}
+	case "update", "delete", "with":
+		return unfilteredWrite(tokens)
+	}
+	return ""
+}
+
+// unfilteredWrite looks for an UPDATE or DELETE, including ones in data-modifying CTEs, that
+// has no WHERE clause of its own.
+func unfilteredWrite(tokens []Token) string {
+	for i, t := range tokens {
+		if t.Kind != Word || (t.Value != "update" && t.Value != "delete") {
+			continue
+		}
+		// FOR [NO KEY] UPDATE locks rows, ON CONFLICT DO UPDATE filters on the conflict,
+		// and MERGE's WHEN ... THEN UPDATE|DELETE on its join condition.
+		if i > 0 && tokens[i-1].Kind == Word {
+			switch tokens[i-1].Value {
+			case "for", "key", "do", "then":
+				continue
+			}
+		}
+		if hasWhere(tokens[i+1:]) {
+			continue
+		}
+		if t.Value == "delete" {
+			return "DELETE without WHERE removes every row"
+		}
+		return "UPDATE without WHERE changes every row"
+	}
+	return ""
+}
+
+// hasWhere reports whether a WHERE follows at the current nesting level, before that level is
+// closed.
+func hasWhere(tokens []Token) bool {
+	depth := 0
+	for _, t := range tokens {
+		switch {
+		case t.Kind == Punct && t.Value == "(":
+			depth++
+		case t.Kind == Punct && t.Value == ")":
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case depth == 0 && t.Kind == Word && t.Value == "where":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package sqlparse
+
+import "testing"
+
+func TestIsReadOnly(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"SELECT 1", true},
+		{"select * from t where a = 1; SHOW search_path", true},
+		{"(SELECT 1) UNION (SELECT 2)", true},
+		{"VALUES (1), (2)", true},
+		{"TABLE t", true},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", true},
+		{"SELECT 'delete from t', \"update\" FROM t", true},
+
+		{"SELECT * INTO new_t FROM t", false},
+		{"SELECT a, (SELECT b FROM u LIMIT 1) INTO new_t FROM t", false},
+		{"SELECT ARRAY(SELECT 1) AS a", true},
+		{"WITH x AS (SELECT 1) SELECT * INTO new_t FROM x", false},
+		{"WITH d AS (DELETE FROM t RETURNING *) SELECT * FROM d", false},
+		{"WITH u AS (UPDATE t SET a = 1 WHERE b RETURNING *) SELECT 1", false},
+		{"WITH x AS (SELECT 1) INSERT INTO t SELECT * FROM x", false},
+
+		{"EXPLAIN DELETE FROM t", true},
+		{"EXPLAIN (COSTS off) UPDATE t SET a = 1", true},
+		{"EXPLAIN ANALYZE DELETE FROM t", false},
+		{"EXPLAIN ANALYSE VERBOSE DELETE FROM t", false},
+		{"EXPLAIN (ANALYZE, BUFFERS) UPDATE t SET a = 1", false},
+		{"EXPLAIN (ANALYZE off) DELETE FROM t", true},
+		{"EXPLAIN (ANALYZE false) DELETE FROM t", true},
+		{"EXPLAIN (ANALYZE 0) DELETE FROM t", true},
+		{"EXPLAIN ANALYZE SELECT 1", true},
+
+		{"SELECT set_config('default_transaction_read_only', 'off', false)", false},
+		{"SELECT pg_catalog.set_config('transaction_read_only', 'off', true)", false},
+		{`SELECT "set_config"('default_transaction_read_only', 'off', false)`, false},
+		{"VALUES (set_config('search_path', 'x', false))", false},
+		{"WITH s AS (SELECT set_config('default_transaction_read_only', 'off', false)) SELECT * FROM s", false},
+		{"SET default_transaction_read_only = off", false},
+		{"SET SESSION CHARACTERISTICS AS TRANSACTION READ WRITE", false},
+		{"RESET ALL", false},
+
+		{"INSERT INTO t VALUES (1)", false},
+		{"DELETE FROM t WHERE id = 1", false},
+		{"BEGIN", false},
+		{"SELECT 1; DROP TABLE t", false},
+		{"COPY t TO STDOUT", false},
+		{"", true},
+	}
+	for _, tt := range tests {
+		got, err := IsReadOnly(tt.sql)
+		if err != nil {
+			t.Errorf("IsReadOnly(%q): %v", tt.sql, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("IsReadOnly(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestIsReadOnlyParseError(t *testing.T) {
+	if _, err := IsReadOnly("SELECT 'unterminated"); err == nil {
+		t.Error("IsReadOnly accepted an unterminated string")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	const (
+		deleteAll = "DELETE without WHERE removes every row"
+		updateAll = "UPDATE without WHERE changes every row"
+	)
+	tests := []struct {
+		sql     string
+		command string
+		reason  string
+	}{
+		{"DELETE FROM t", "DELETE", deleteAll},
+		{"delete from t where id = 1", "DELETE", ""},
+		{"DELETE FROM t USING u WHERE t.id = u.id", "DELETE", ""},
+		{"DELETE FROM t WHERE CURRENT OF c", "DELETE", ""},
+		{"UPDATE t SET a = 1", "UPDATE", updateAll},
+		{"UPDATE t SET a = 1 WHERE b", "UPDATE", ""},
+		{"UPDATE t SET a = (SELECT max(x) FROM u WHERE u.id = 1)", "UPDATE", updateAll},
+		{"UPDATE t SET a = u.a FROM u", "UPDATE", updateAll},
+		{"UPDATE t SET a = 1 -- WHERE id = 1", "UPDATE", updateAll},
+		{"UPDATE t SET a = 'where'", "UPDATE", updateAll},
+
+		{"WITH d AS (DELETE FROM t RETURNING *) SELECT * FROM d WHERE id = 1", "WITH", deleteAll},
+		{"WITH d AS (DELETE FROM t WHERE a RETURNING *) SELECT * FROM d", "WITH", ""},
+		{"WITH u AS (UPDATE t SET a = 1 RETURNING *) SELECT 1", "WITH", updateAll},
+		{"WITH x AS (SELECT id FROM u WHERE ok) DELETE FROM t", "WITH", deleteAll},
+		{"WITH x AS (SELECT id FROM u) DELETE FROM t WHERE id IN (SELECT id FROM x)", "WITH", ""},
+		{"WITH x AS (SELECT * FROM t FOR UPDATE) SELECT * FROM x", "WITH", ""},
+		{"WITH x AS (SELECT * FROM t FOR NO KEY UPDATE) SELECT * FROM x", "WITH", ""},
+
+		{"TRUNCATE t", "TRUNCATE", "TRUNCATE removes every row"},
+		{"DROP TABLE t", "DROP", "DROP removes the object and everything stored in it"},
+		{"drop index if exists i", "DROP", "DROP removes the object and everything stored in it"},
+		{"ALTER TABLE t ADD COLUMN c int", "ALTER", "ALTER changes the schema and may rewrite or discard data"},
+
+		{"EXPLAIN DELETE FROM t", "EXPLAIN", ""},
+		{"EXPLAIN ANALYZE DELETE FROM t", "EXPLAIN", deleteAll},
+		{"EXPLAIN (ANALYZE, BUFFERS) UPDATE t SET a = 1", "EXPLAIN", updateAll},
+		{"EXPLAIN (ANALYZE off) UPDATE t SET a = 1", "EXPLAIN", ""},
+		{"EXPLAIN ANALYZE UPDATE t SET a = 1 WHERE id = 1", "EXPLAIN", ""},
+
+		{"SELECT * FROM t FOR UPDATE", "SELECT", ""},
+		{"INSERT INTO t VALUES (1) ON CONFLICT (id) DO UPDATE SET a = 1", "INSERT", ""},
+		{"MERGE INTO t USING u ON t.id = u.id WHEN MATCHED THEN DELETE", "MERGE", ""},
+		{"CREATE TRIGGER tr AFTER DELETE ON t FOR EACH ROW EXECUTE FUNCTION f()", "CREATE", ""},
+		{"(SELECT 1)", "SELECT", ""},
+		{"SELECT 'DROP TABLE t'", "SELECT", ""},
+	}
+	for _, tt := range tests {
+		list, err := Classify(tt.sql)
+		if err != nil {
+			t.Errorf("Classify(%q): %v", tt.sql, err)
+			continue
+		}
+		if len(list) != 1 {
+			t.Errorf("Classify(%q) returned %d statements, want 1", tt.sql, len(list))
+			continue
+		}
+		c := list[0]
+		if c.Command != tt.command || c.Reason != tt.reason || c.Destructive != (tt.reason != "") {
+			t.Errorf("Classify(%q) = %+v, want command %q, reason %q", tt.sql, c, tt.command, tt.reason)
+		}
+		if c.Statement != tt.sql {
+			t.Errorf("Classify(%q).Statement = %q", tt.sql, c.Statement)
+		}
+	}
+}
+
+func TestClassifyScript(t *testing.T) {
+	list, err := Classify("SELECT 1; DELETE FROM t; UPDATE t SET a = 1 WHERE id = 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		command               string
+		readOnly, destructive bool
+	}{
+		{"SELECT", true, false},
+		{"DELETE", false, true},
+		{"UPDATE", false, false},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("Classify returned %d statements, want %d", len(list), len(want))
+	}
+	for i, w := range want {
+		c := list[i]
+		if c.Command != w.command || c.ReadOnly != w.readOnly || c.Destructive != w.destructive {
+			t.Errorf("statement %d = %+v, want %+v", i, c, w)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package sqlparse
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// TokenKind identifies the lexical class of a Token.
+type TokenKind int
+
+const (
+	Word        TokenKind = iota // keyword or unquoted identifier, lowercased in Token.Value
+	QuotedIdent                  // "identifier"
+	String                       // 'literal', E'literal' or $tag$literal$tag$
+	Number
+	Param     // $1, $2, ...
+	Punct     // operators and punctuation other than ';'
+	Semicolon // statement terminator
+)
+
+// Token is one lexical element of a SQL string. Comments and whitespace are dropped.
+type Token struct {
+	Kind TokenKind
+	// Value is the lowercased text for Word tokens and the raw text otherwise.
+	Value string
+	// Start and End are byte offsets of the token in the source.
+	Start, End int
+}
+
+// Tokenize splits sql into tokens following PostgreSQL's lexical rules closely enough to find
+// statement boundaries and keywords: it understands standard and escape strings, dollar
+// quoting, quoted identifiers, and nested block comments.
+func Tokenize(sql string) ([]Token, error) {
+	tokens := make([]Token, 0)
+	i := 0
+	for i < len(sql) {
+		c := sql[i]
+		switch {
+		case isSpace(c):
+			i++
+
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			end, err := skipBlockComment(sql, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+
+		case c == '\'':
+			end, err := scanString(sql, i+1, false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, Token{Kind: String, Value: sql[i:end], Start: i, End: end})
+			i = end
+
+		case (c == 'e' || c == 'E') && i+1 < len(sql) && sql[i+1] == '\'':
+			end, err := scanString(sql, i+2, true)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, Token{Kind: String, Value: sql[i:end], Start: i, End: end})
+			i = end
+
+		case c == '"':
+			end := i + 1
+			for {
+				j := strings.IndexByte(sql[end:], '"')
+				if j < 0 {
+					return nil, fmt.Errorf("unterminated quoted identifier at offset %d", i)
+				}
+				end += j + 1
+				if end < len(sql) && sql[end] == '"' {
+					end++
+					continue
+				}
+				break
+			}
+			tokens = append(tokens, Token{Kind: QuotedIdent, Value: sql[i:end], Start: i, End: end})
+			i = end
+
+		case c == '$' && i+1 < len(sql) && isDigit(sql[i+1]):
+			end := i + 1
+			for end < len(sql) && isDigit(sql[end]) {
+				end++
+			}
+			tokens = append(tokens, Token{Kind: Param, Value: sql[i:end], Start: i, End: end})
+			i = end
+
+		case c == '$':
+			tag, ok := dollarTag(sql, i)
+			if !ok {
+				tokens = append(tokens, Token{Kind: Punct, Value: "$", Start: i, End: i + 1})
+				i++
+				continue
+			}
+			j := strings.Index(sql[i+len(tag):], tag)
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated dollar-quoted string at offset %d", i)
+			}
+			end := i + len(tag) + j + len(tag)
+			tokens = append(tokens, Token{Kind: String, Value: sql[i:end], Start: i, End: end})
+			i = end
+
+		case isDigit(c) || (c == '.' && i+1 < len(sql) && isDigit(sql[i+1])):
+			end := i
+			for end < len(sql) && (isDigit(sql[end]) || sql[end] == '.' || sql[end] == '_' ||
+				sql[end] == 'e' || sql[end] == 'E' ||
+				((sql[end] == '+' || sql[end] == '-') && (sql[end-1] == 'e' || sql[end-1] == 'E'))) {
+				end++
+			}
+			tokens = append(tokens, Token{Kind: Number, Value: sql[i:end], Start: i, End: end})
+			i = end
+
+		case isIdentStart(c):
+			end := i
+			for end < len(sql) && isIdentPart(sql[end]) {
+				end++
+			}
+			tokens = append(tokens, Token{Kind: Word, Value: strings.ToLower(sql[i:end]), Start: i, End: end})
+			i = end
+
+		case c == ';':
+			tokens = append(tokens, Token{Kind: Semicolon, Value: ";", Start: i, End: i + 1})
+			i++
+
+		default:
+			tokens = append(tokens, Token{Kind: Punct, Value: sql[i : i+1], Start: i, End: i + 1})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// scanString returns the offset just past the closing quote of a string whose body starts at i.
+func scanString(sql string, i int, backslashEscapes bool) (int, error) {
+	start := i - 1
+	for i < len(sql) {
+		switch sql[i] {
+		case '\\':
+			if backslashEscapes {
+				i += 2
+				continue
+			}
+		case '\'':
+			if i+1 < len(sql) && sql[i+1] == '\'' {
+				i += 2
+				continue
+			}
+			return i + 1, nil
+		}
+		i++
+	}
+	return 0, fmt.Errorf("unterminated string literal at offset %d", start)
+}
+
+// skipBlockComment returns the offset just past a (possibly nested) /* */ comment starting at i.
+func skipBlockComment(sql string, i int) (int, error) {
+	start := i
+	depth := 0
+	for i < len(sql) {
+		switch {
+		case strings.HasPrefix(sql[i:], "/*"):
+			depth++
+			i += 2
+		case strings.HasPrefix(sql[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i, nil
+			}
+		default:
+			i++
+		}
+	}
+	return 0, fmt.Errorf("unterminated block comment at offset %d", start)
+}
+
+// dollarTag returns the opening $tag$ delimiter at i, if one is there.
+func dollarTag(sql string, i int) (string, bool) {
+	end := i + 1
+	for end < len(sql) && sql[end] != '$' {
+		if !isIdentPart(sql[end]) {
+			return "", false
+		}
+		end++
+	}
+	if end >= len(sql) {
+		return "", false
+	}
+	return sql[i : end+1], true
+}
+
+func isSpace(c byte) bool { return unicode.IsSpace(rune(c)) }
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '$'
+}
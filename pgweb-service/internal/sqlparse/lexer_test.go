@@ -0,0 +1,116 @@
+package sqlparse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	type tok struct {
+		Kind  TokenKind
+		Value string
+	}
+	tests := []struct {
+		name string
+		sql  string
+		want []tok
+	}{
+		{
+			name: "keywords are lowercased",
+			sql:  "SELECT Id FROM T",
+			want: []tok{{Word, "select"}, {Word, "id"}, {Word, "from"}, {Word, "t"}},
+		},
+		{
+			name: "standard string with doubled quote",
+			sql:  "'it''s; fine'",
+			want: []tok{{String, "'it''s; fine'"}},
+		},
+		{
+			name: "escape string with backslash-escaped quote",
+			sql:  `E'a\'b;' x`,
+			want: []tok{{String, `E'a\'b;'`}, {Word, "x"}},
+		},
+		{
+			name: "backslash is literal in a standard string",
+			sql:  `'a\' x`,
+			want: []tok{{String, `'a\'`}, {Word, "x"}},
+		},
+		{
+			name: "dollar quote",
+			sql:  "$$ a; 'b $$",
+			want: []tok{{String, "$$ a; 'b $$"}},
+		},
+		{
+			name: "tagged dollar quote containing another tag",
+			sql:  "$fn$ SELECT $$;$$ $fn$;",
+			want: []tok{{String, "$fn$ SELECT $$;$$ $fn$"}, {Semicolon, ";"}},
+		},
+		{
+			name: "positional parameters",
+			sql:  "$1 + $12",
+			want: []tok{{Param, "$1"}, {Punct, "+"}, {Param, "$12"}},
+		},
+		{
+			name: "quoted identifier with doubled quote",
+			sql:  `"a""b;" c`,
+			want: []tok{{QuotedIdent, `"a""b;"`}, {Word, "c"}},
+		},
+		{
+			name: "line comment",
+			sql:  "a -- b; c\nd",
+			want: []tok{{Word, "a"}, {Word, "d"}},
+		},
+		{
+			name: "nested block comment",
+			sql:  "a /* b /* c; */ d; */ e",
+			want: []tok{{Word, "a"}, {Word, "e"}},
+		},
+		{
+			name: "numbers",
+			sql:  "1 2.5 .5 1e-3 1_000",
+			want: []tok{{Number, "1"}, {Number, "2.5"}, {Number, ".5"}, {Number, "1e-3"}, {Number, "1_000"}},
+		},
+		{
+			name: "identifiers may contain dollar signs",
+			sql:  "a$b",
+			want: []tok{{Word, "a$b"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := Tokenize(tt.sql)
+			if err != nil {
+				t.Fatalf("Tokenize(%q): %v", tt.sql, err)
+			}
+			got := make([]tok, len(tokens))
+			for i, token := range tokens {
+				got[i] = tok{token.Kind, token.Value}
+				if token.Kind != Word && tt.sql[token.Start:token.End] != token.Value {
+					t.Errorf("token %d offsets [%d:%d] = %q, want %q", i, token.Start, token.End, tt.sql[token.Start:token.End], token.Value)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %v, want %v", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenizeUnterminated(t *testing.T) {
+	tests := map[string]string{
+		"string":            "SELECT 'abc",
+		"escape string":     `SELECT E'abc\'`,
+		"quoted identifier": `SELECT "abc`,
+		"dollar quote":      "SELECT $x$ abc $y$",
+		"block comment":     "SELECT /* a /* b */",
+	}
+	for name, sql := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Tokenize(sql)
+			if err == nil || !strings.Contains(err.Error(), "unterminated") {
+				t.Errorf("Tokenize(%q) error = %v, want an unterminated error", sql, err)
+			}
+		})
+	}
+}
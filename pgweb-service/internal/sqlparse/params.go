@@ -0,0 +1,34 @@
+package sqlparse
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Placeholders returns the distinct $n parameter numbers used in sql, in ascending order.
+// Parameters inside strings, comments and quoted identifiers are ignored.
+func Placeholders(sql string) ([]int, error) {
+	tokens, err := Tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	for _, t := range tokens {
+		if t.Kind != Param {
+			continue
+		}
+		n, err := strconv.Atoi(t.Value[1:])
+		if err != nil {
+			return nil, err
+		}
+		seen[n] = true
+	}
+
+	numbers := make([]int, 0, len(seen))
+	for n := range seen {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
@@ -0,0 +1,38 @@
+package sqlparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlaceholders(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want []int
+	}{
+		{"SELECT 1", []int{}},
+		{"SELECT $1, $2", []int{1, 2}},
+		{"SELECT $2 WHERE a = $1 OR b = $1", []int{1, 2}},
+		{"SELECT $10, $9", []int{9, 10}},
+		{"SELECT $1 -- $2\n/* $3 */", []int{1}},
+		{`SELECT '$1', "$2", E'\'$3', $4`, []int{4}},
+		{"SELECT $$ $1 $$, $tag$ $2 $tag$, $3", []int{3}},
+		{"SELECT a$1 FROM t", []int{}},
+	}
+	for _, tt := range tests {
+		got, err := Placeholders(tt.sql)
+		if err != nil {
+			t.Errorf("Placeholders(%q): %v", tt.sql, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Placeholders(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestPlaceholdersParseError(t *testing.T) {
+	if _, err := Placeholders("SELECT $1, 'unterminated"); err == nil {
+		t.Error("Placeholders accepted an unterminated string")
+	}
+}
@@ -0,0 +1,66 @@
+package sqlparse
+
+import "strings"
+
+// Statement is a single statement of a script.
+type Statement struct {
+	// Text is the statement source, trimmed and without its terminating semicolon.
+	Text string
+	// Tokens are the statement's tokens with offsets relative to Text.
+	Tokens []Token
+}
+
+// Split breaks a script into statements at top-level semicolons, ignoring semicolons inside
+// strings, dollar-quoted bodies, quoted identifiers, comments and the BEGIN ATOMIC ... END
+// bodies of SQL-standard functions and procedures. Statements made only of whitespace or
+// comments are dropped.
+func Split(script string) ([]Statement, error) {
+	tokens, err := Tokenize(script)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := make([]Statement, 0)
+	start := 0
+	var pending []Token
+	flush := func(end int) {
+		if len(pending) > 0 {
+			raw := script[start:end]
+			trimmed := strings.TrimSpace(raw)
+			offset := start + strings.Index(raw, trimmed)
+			stmt := Statement{Text: trimmed, Tokens: make([]Token, len(pending))}
+			for i, t := range pending {
+				t.Start -= offset
+				t.End -= offset
+				stmt.Tokens[i] = t
+			}
+			statements = append(statements, stmt)
+		}
+		pending = nil
+	}
+
+	// atomic counts the open BEGIN ATOMIC body and the CASE expressions inside it, since both
+	// are closed by END.
+	atomic := 0
+	for _, t := range tokens {
+		if t.Kind == Semicolon && atomic == 0 {
+			flush(t.Start)
+			start = t.End
+			continue
+		}
+		if t.Kind == Word && len(pending) > 0 && pending[0].Kind == Word && pending[0].Value == "create" {
+			switch {
+			case t.Value == "atomic" && pending[len(pending)-1].Kind == Word && pending[len(pending)-1].Value == "begin":
+				atomic++
+			case t.Value == "case" && atomic > 0:
+				atomic++
+			case t.Value == "end" && atomic > 0:
+				atomic--
+			}
+		}
+		pending = append(pending, t)
+	}
+	flush(len(script))
+
+	return statements, nil
+}
@@ -0,0 +1,101 @@
+package sqlparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "plain statements",
+			script: "SELECT 1; SELECT 2;",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "missing final semicolon",
+			script: "SELECT 1;\n  SELECT 2  ",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "semicolons in strings and identifiers",
+			script: `SELECT 'a;b', E'c\';d', "e;f"; SELECT 2`,
+			want:   []string{`SELECT 'a;b', E'c\';d', "e;f"`, "SELECT 2"},
+		},
+		{
+			name:   "dollar-quoted function body",
+			script: "CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END $body$ LANGUAGE plpgsql; SELECT f()",
+			want: []string{
+				"CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END $body$ LANGUAGE plpgsql",
+				"SELECT f()",
+			},
+		},
+		{
+			name:   "comments",
+			script: "SELECT 1 -- first; still a comment\n; /* a; /* nested; */ b; */ SELECT 2",
+			want:   []string{"SELECT 1 -- first; still a comment", "/* a; /* nested; */ b; */ SELECT 2"},
+		},
+		{
+			name:   "empty and comment-only statements are dropped",
+			script: "; ;\n-- nothing\n; SELECT 1;;",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "BEGIN ATOMIC body",
+			script: "CREATE FUNCTION f() RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT 1; SELECT 2; END; SELECT 3",
+			want: []string{
+				"CREATE FUNCTION f() RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT 1; SELECT 2; END",
+				"SELECT 3",
+			},
+		},
+		{
+			name:   "CASE inside a BEGIN ATOMIC body",
+			script: "CREATE PROCEDURE p() BEGIN ATOMIC SELECT CASE WHEN true THEN 1 END; END; SELECT 2",
+			want: []string{
+				"CREATE PROCEDURE p() BEGIN ATOMIC SELECT CASE WHEN true THEN 1 END; END",
+				"SELECT 2",
+			},
+		},
+		{
+			name:   "transaction BEGIN and END are ordinary statements",
+			script: "BEGIN; SELECT CASE WHEN true THEN 1 END; END;",
+			want:   []string{"BEGIN", "SELECT CASE WHEN true THEN 1 END", "END"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements, err := Split(tt.script)
+			if err != nil {
+				t.Fatalf("Split: %v", err)
+			}
+			got := make([]string, len(statements))
+			for i, st := range statements {
+				got[i] = st.Text
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split(%q) =\n%q\nwant\n%q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitTokenOffsets(t *testing.T) {
+	statements, err := Split("  SELECT a;\n\tUPDATE t SET b = 'x'  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range statements {
+		for _, tok := range st.Tokens {
+			if tok.Kind == Word {
+				continue
+			}
+			if got := st.Text[tok.Start:tok.End]; got != tok.Value {
+				t.Errorf("%q: token at [%d:%d] = %q, want %q", st.Text, tok.Start, tok.End, got, tok.Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package sqlparse
+
+// Variable is one {{name}} placeholder in a SQL template.
+type Variable struct {
+	Name string
+	// Start and End are byte offsets of the whole placeholder, braces included.
+	Start, End int
+}
+
+// Variables returns the {{name}} placeholders in sql in source order, repeats included.
+// Spaces are allowed inside the braces; braces inside strings, comments and quoted
+// identifiers are not placeholders.
+func Variables(sql string) ([]Variable, error) {
+	tokens, err := Tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	isBrace := func(t Token, brace string) bool { return t.Kind == Punct && t.Value == brace }
+
+	vars := make([]Variable, 0)
+	for i := 0; i+4 < len(tokens); i++ {
+		open1, open2, name, close1, close2 := tokens[i], tokens[i+1], tokens[i+2], tokens[i+3], tokens[i+4]
+		if !isBrace(open1, "{") || !isBrace(open2, "{") || open1.End != open2.Start ||
+			name.Kind != Word ||
+			!isBrace(close1, "}") || !isBrace(close2, "}") || close1.End != close2.Start {
+			continue
+		}
+		vars = append(vars, Variable{Name: sql[name.Start:name.End], Start: open1.Start, End: close2.End})
+		i += 4
+	}
+	return vars, nil
+}
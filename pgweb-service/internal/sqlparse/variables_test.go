@@ -0,0 +1,41 @@
+package sqlparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVariables(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want []Variable
+	}{
+		{"SELECT 1", []Variable{}},
+		{"SELECT {{a}}", []Variable{{Name: "a", Start: 7, End: 12}}},
+		{"SELECT {{ a }}, {{b}}, {{ a}}", []Variable{
+			{Name: "a", Start: 7, End: 14},
+			{Name: "b", Start: 16, End: 21},
+			{Name: "a", Start: 23, End: 29},
+		}},
+		{"SELECT {{Mixed_Case1}}", []Variable{{Name: "Mixed_Case1", Start: 7, End: 22}}},
+		{`SELECT '{{a}}', "{{b}}", $$ {{c}} $$ -- {{d}}` + "\n/* {{e}} */", []Variable{}},
+		{"SELECT { {a} }, {{1}}, {{a b}}, {{a}", []Variable{}},
+		{"SELECT '{' || {{x}} || '}'", []Variable{{Name: "x", Start: 14, End: 19}}},
+	}
+	for _, tt := range tests {
+		got, err := Variables(tt.sql)
+		if err != nil {
+			t.Errorf("Variables(%q): %v", tt.sql, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Variables(%q) = %+v, want %+v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestVariablesParseError(t *testing.T) {
+	if _, err := Variables("SELECT {{a}}, 'unterminated"); err == nil {
+		t.Error("Variables accepted an unterminated string")
+	}
+}
@@ -0,0 +1,281 @@
+package util
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq/oid"
+)
+
+// Column describes one result column. OID and Type come from the driver's type name; types
+// it has no name for (enums, composites, extension types) report OID 0 and type "unknown".
+// Nullable is only known when the endpoint reads a single table; lib/pq drops the source
+// column from the row description, so it is null for ad-hoc query results.
+type Column struct {
+	Name     string `json:"name"`
+	OID      uint32 `json:"oid"`
+	Type     string `json:"type"`
+	Nullable *bool  `json:"nullable"`
+}
+
+var typeOIDs = func() map[string]oid.Oid {
+	m := make(map[string]oid.Oid, len(oid.TypeName))
+	for o, name := range oid.TypeName {
+		m[strings.ToLower(name)] = o
+	}
+	return m
+}()
+
+func newColumn(name, dbType string) Column {
+	typ := strings.ToLower(dbType)
+	o, ok := typeOIDs[typ]
+	if !ok {
+		typ = "unknown"
+	}
+	return Column{Name: name, OID: uint32(o), Type: typ}
+}
+
+// DriverColumns describes the columns of rows read straight from the driver.
+func DriverColumns(rows driver.Rows) []Column {
+	names := rows.Columns()
+	typed, _ := rows.(driver.RowsColumnTypeDatabaseTypeName)
+
+	columns := make([]Column, len(names))
+	for i, name := range names {
+		var dbType string
+		if typed != nil {
+			dbType = typed.ColumnTypeDatabaseTypeName(i)
+		}
+		columns[i] = newColumn(name, dbType)
+	}
+	return columns
+}
+
+// SQLColumns describes the columns of rows.
+func SQLColumns(rows *sql.Rows) ([]Column, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]Column, len(types))
+	for i, t := range types {
+		columns[i] = newColumn(t.Name(), t.DatabaseTypeName())
+	}
+	return columns, nil
+}
+
+// EncodeRow turns one row of driver values into JSON-ready values, in column order.
+func EncodeRow(columns []Column, values []driver.Value) []any {
+	row := make([]any, len(columns))
+	for i, col := range columns {
+		row[i] = EncodeValue(col.Type, values[i])
+	}
+	return row
+}
+
+// EncodeValue converts a value decoded by lib/pq into its JSON representation:
+//
+//   - json/jsonb are embedded as JSON, arrays become JSON arrays;
+//   - bytea becomes a base64 string;
+//   - numeric stays an exact decimal string, and non-finite floats become "NaN"/"Infinity";
+//   - dates and times are formatted like Postgres would, without inventing a time zone;
+//   - everything else (uuid, interval, inet, enums, ...) is the server's text form.
+func EncodeValue(typ string, v driver.Value) any {
+	switch v := v.(type) {
+	case nil, bool, int64, string:
+		return v
+	case float64:
+		return encodeFloat(v)
+	case time.Time:
+		return encodeTime(typ, v)
+	case []byte:
+		if typ == "bytea" {
+			return v
+		}
+		if elem, ok := strings.CutPrefix(typ, "_"); ok {
+			if arr, err := parseArray(string(v), elem); err == nil {
+				return arr
+			}
+		}
+		return encodeText(typ, string(v))
+	default:
+		return v
+	}
+}
+
+func encodeFloat(f float64) any {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return f
+}
+
+func encodeTime(typ string, t time.Time) string {
+	switch typ {
+	case "date":
+		return t.Format("2006-01-02")
+	case "time":
+		return t.Format("15:04:05.999999")
+	case "timetz":
+		return t.Format("15:04:05.999999Z07:00")
+	case "timestamp":
+		return t.Format("2006-01-02T15:04:05.999999")
+	default:
+		return t.Format("2006-01-02T15:04:05.999999Z07:00")
+	}
+}
+
+// encodeText converts the text form of a scalar, as found in array literals and for types
+// lib/pq leaves undecoded.
+func encodeText(typ, s string) any {
+	switch typ {
+	case "bool":
+		return s == "t"
+	case "int2", "int4", "int8", "oid":
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case "float4", "float8":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return encodeFloat(f)
+		}
+	case "json", "jsonb":
+		if json.Valid([]byte(s)) {
+			return json.RawMessage(s)
+		}
+	case "bytea":
+		if b, err := hex.DecodeString(strings.TrimPrefix(s, `\x`)); err == nil {
+			return b
+		}
+	}
+	return s
+}
+
+// parseArray parses a Postgres array literal such as {1,2,NULL} or [0:1]={{"a b",c}} into
+// nested slices, converting each element with encodeText.
+func parseArray(s, elem string) (any, error) {
+	if strings.HasPrefix(s, "[") {
+		// Skip the explicit dimensions decoration.
+		i := strings.Index(s, "=")
+		if i < 0 {
+			return nil, errors.New("malformed array dimensions")
+		}
+		s = s[i+1:]
+	}
+
+	delim := byte(',')
+	if elem == "box" {
+		delim = ';'
+	}
+
+	p := arrayParser{s: s, elem: elem, delim: delim}
+	v, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(s) {
+		return nil, errors.New("trailing data after array")
+	}
+	return v, nil
+}
+
+type arrayParser struct {
+	s     string
+	pos   int
+	elem  string
+	delim byte
+}
+
+func (p *arrayParser) parse() ([]any, error) {
+	if p.pos >= len(p.s) || p.s[p.pos] != '{' {
+		return nil, errors.New("expected '{'")
+	}
+	p.pos++
+
+	items := make([]any, 0)
+	if p.pos < len(p.s) && p.s[p.pos] == '}' {
+		p.pos++
+		return items, nil
+	}
+
+	for {
+		if p.pos >= len(p.s) {
+			return nil, errors.New("unterminated array")
+		}
+
+		switch p.s[p.pos] {
+		case '{':
+			sub, err := p.parse()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, sub)
+		case '"':
+			text, err := p.quoted()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, encodeText(p.elem, text))
+		default:
+			start := p.pos
+			for p.pos < len(p.s) && p.s[p.pos] != p.delim && p.s[p.pos] != '}' {
+				p.pos++
+			}
+			text := strings.TrimSpace(p.s[start:p.pos])
+			if strings.EqualFold(text, "NULL") {
+				items = append(items, nil)
+			} else {
+				items = append(items, encodeText(p.elem, text))
+			}
+		}
+
+		if p.pos >= len(p.s) {
+			return nil, errors.New("unterminated array")
+		}
+		switch p.s[p.pos] {
+		case p.delim:
+			p.pos++
+		case '}':
+			p.pos++
+			return items, nil
+		default:
+			return nil, errors.New("unexpected character in array")
+		}
+	}
+}
+
+func (p *arrayParser) quoted() (string, error) {
+	p.pos++ // opening quote
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch c {
+		case '\\':
+			if p.pos+1 >= len(p.s) {
+				return "", errors.New("unterminated escape in array")
+			}
+			b.WriteByte(p.s[p.pos+1])
+			p.pos += 2
+		case '"':
+			p.pos++
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", errors.New("unterminated quoted array element")
+}
@@ -0,0 +1,110 @@
+package util
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq/oid"
+)
+
+func TestParseArray(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		elem string
+		want any
+	}{
+		{"integers", "{1,2,3}", "int4", []any{int64(1), int64(2), int64(3)}},
+		{"empty", "{}", "int4", []any{}},
+		{"NULL elements", "{1,NULL,null}", "int8", []any{int64(1), nil, nil}},
+		{"quoted NULL is a string", `{"NULL",x}`, "text", []any{"NULL", "x"}},
+		{"quoted elements with escapes", `{"a b","c,d","e\"f","g\\h"}`, "text", []any{"a b", "c,d", `e"f`, `g\h`}},
+		{"nested", "{{1,2},{3,4}}", "int2", []any{[]any{int64(1), int64(2)}, []any{int64(3), int64(4)}}},
+		{"explicit dimensions", "[0:1]={t,f}", "bool", []any{true, false}},
+		{"box uses semicolons", "{(1,1),(0,0);(2,2),(1,1)}", "box", []any{"(1,1),(0,0)", "(2,2),(1,1)"}},
+		{"floats", "{1.5,NaN,-Infinity}", "float8", []any{1.5, "NaN", "-Infinity"}},
+		{"jsonb", `{"{\"a\":1}"}`, "jsonb", []any{json.RawMessage(`{"a":1}`)}},
+		{"bytea", `{"\\x0102"}`, "bytea", []any{[]byte{1, 2}}},
+		{"unknown element type stays text", "{x,y}", "mood", []any{"x", "y"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseArray(tt.s, tt.elem)
+			if err != nil {
+				t.Fatalf("parseArray(%q): %v", tt.s, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseArray(%q) = %#v, want %#v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArrayErrors(t *testing.T) {
+	tests := map[string]string{
+		"not an array":        "1,2",
+		"unterminated":        "{1,2",
+		"unterminated quote":  `{"abc}`,
+		"unterminated escape": `{"abc\`,
+		"trailing data":       "{1}x",
+		"dimensions only":     "[1:2]",
+		"junk after element":  `{"a"b}`,
+	}
+	for name, s := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got, err := parseArray(s, "text"); err == nil {
+				t.Errorf("parseArray(%q) = %#v, want an error", s, got)
+			}
+		})
+	}
+}
+
+func TestEncodeValue(t *testing.T) {
+	ts := time.Date(2026, 3, 4, 5, 6, 7, 890000000, time.FixedZone("", 2*3600))
+	tests := []struct {
+		typ  string
+		v    driver.Value
+		want any
+	}{
+		{"int4", int64(7), int64(7)},
+		{"text", "x", "x"},
+		{"float8", math.Inf(1), "Infinity"},
+		{"numeric", []byte("12345678901234567890.5"), "12345678901234567890.5"},
+		{"jsonb", []byte(`{"a": [1]}`), json.RawMessage(`{"a": [1]}`)},
+		{"json", []byte(`not json`), "not json"},
+		{"bytea", []byte{0, 1}, []byte{0, 1}},
+		{"_int4", []byte("{1,2}"), []any{int64(1), int64(2)}},
+		{"_text", []byte("{broken"), "{broken"},
+		{"date", ts, "2026-03-04"},
+		{"timestamp", ts, "2026-03-04T05:06:07.89"},
+		{"timestamptz", ts, "2026-03-04T05:06:07.89+02:00"},
+		{"unknown", []byte("happy"), "happy"},
+		{"int4", nil, nil},
+	}
+	for _, tt := range tests {
+		got := EncodeValue(tt.typ, tt.v)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("EncodeValue(%q, %#v) = %#v, want %#v", tt.typ, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestNewColumn(t *testing.T) {
+	tests := []struct {
+		dbType string
+		want   Column
+	}{
+		{"INT4", Column{Name: "c", OID: uint32(oid.T_int4), Type: "int4"}},
+		{"_TEXT", Column{Name: "c", OID: uint32(oid.T__text), Type: "_text"}},
+		{"", Column{Name: "c", OID: 0, Type: "unknown"}},
+	}
+	for _, tt := range tests {
+		if got := newColumn("c", tt.dbType); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("newColumn(%q) = %+v, want %+v", tt.dbType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// NDJSONWriter streams newline-delimited JSON values, flushing them to the client every
+// flushEvery lines so large results never sit in memory.
+type NDJSONWriter struct {
+	w          http.ResponseWriter
+	rc         *http.ResponseController
+	enc        *json.Encoder
+	flushEvery int
+	pending    int
+	started    bool
+}
+
+func NewNDJSONWriter(w http.ResponseWriter, flushEvery int) *NDJSONWriter {
+	return &NDJSONWriter{
+		w:          w,
+		rc:         http.NewResponseController(w),
+		enc:        json.NewEncoder(w),
+		flushEvery: flushEvery,
+	}
+}
+
+// Started reports whether the response header has been sent. After that, errors can only be
+// reported in-band.
+func (n *NDJSONWriter) Started() bool {
+	return n.started
+}
+
+func (n *NDJSONWriter) Write(v any) error {
+	if !n.started {
+		n.w.Header().Set("Content-Type", "application/x-ndjson")
+		n.w.Header().Set("X-Content-Type-Options", "nosniff")
+		n.w.WriteHeader(http.StatusOK)
+		n.started = true
+	}
+	if err := n.enc.Encode(v); err != nil {
+		return err
+	}
+	n.pending++
+	if n.pending >= n.flushEvery {
+		return n.Flush()
+	}
+	return nil
+}
+
+func (n *NDJSONWriter) Flush() error {
+	n.pending = 0
+	if err := n.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
@@ -2,43 +2,52 @@ package util
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
 )
 
-// RowsToMaps consumes sql.Rows and returns column names plus JSON-friendly row maps.
-func RowsToMaps(rows *sql.Rows) ([]string, []map[string]any, error) {
-	columns, err := rows.Columns()
-	if err != nil {
-		return nil, nil, err
+// ReadSQLRows consumes rows and returns every row as values encoded with EncodeValue.
+func ReadSQLRows(rows *sql.Rows, columns []Column) ([][]any, error) {
+	data := make([][]any, 0)
+	values := make([]any, len(columns))
+	scanArgs := make([]any, len(columns))
+	for i := range values {
+		scanArgs[i] = &values[i]
 	}
 
-	data := make([]map[string]any, 0)
 	for rows.Next() {
-		// values represents the actual values
-		values := make([]any, len(columns))
-		// array of ptrs used so rows.Scan can be utilized
-		scanArgs := make([]any, len(columns))
-		for i := range values {
-			scanArgs[i] = &values[i]
-		}
 		if err := rows.Scan(scanArgs...); err != nil {
-			return nil, nil, err
+			return nil, err
 		}
-
-		rowMap := make(map[string]any, len(columns))
+		row := make([]any, len(columns))
 		for i, col := range columns {
-			switch v := values[i].(type) {
-			case []byte:
-				rowMap[col] = string(v)
-			default:
-				rowMap[col] = v
-			}
+			row[i] = EncodeValue(col.Type, values[i])
 		}
-		data = append(data, rowMap)
+		data = append(data, row)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	return data, nil
+}
 
-	return columns, data, nil
+// ReadDriverRows consumes rows read straight from the driver. At most limit rows are read
+// (0 means no limit); truncated reports whether more rows were left unread.
+func ReadDriverRows(rows driver.Rows, columns []Column, limit int) (data [][]any, truncated bool, err error) {
+	data = make([][]any, 0)
+	values := make([]driver.Value, len(columns))
+	for {
+		if err := rows.Next(values); err != nil {
+			if errors.Is(err, io.EOF) {
+				return data, false, nil
+			}
+			return nil, false, err
+		}
+		if limit > 0 && len(data) == limit {
+			return data, true, nil
+		}
+		data = append(data, EncodeRow(columns, values))
+	}
 }